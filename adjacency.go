@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// renderAdjacency writes the graph as a plain edge list, one tab separated
+// FROM, TO and RELATION line per edge, references included. Lines are sorted
+// so the output can be compared with diff.
+func renderAdjacency(out io.Writer, g *graph, opts *options) error {
+	var rows [][3]string
+	for name := range g.refs {
+		if target, ok := g.refTarget(name); ok {
+			rows = append(rows, [3]string{name, target, "ref"})
+		}
+	}
+	for h, es := range g.edges {
+		for _, e := range es {
+			rows = append(rows, [3]string{h.String(), e.target.String(), e.role.String()})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		for k := range rows[i] {
+			if rows[i][k] != rows[j][k] {
+				return rows[i][k] < rows[j][k]
+			}
+		}
+		return false
+	})
+	w := bufio.NewWriter(out)
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r[0], r[1], r[2])
+	}
+	return w.Flush()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+// alternateStorer is a storage.Storer that looks up objects missing from the
+// underlying repository storage in a list of alternate object stores, much
+// like git does with objects/info/alternates.
+type alternateStorer struct {
+	storage.Storer
+	alternates []storer.EncodedObjectStorer
+}
+
+// withAlternates wraps s so that objects are also read from each of the
+// given object directories.
+func withAlternates(s storage.Storer, dirs []string) (storage.Storer, error) {
+	a := &alternateStorer{Storer: s}
+	for _, dir := range dirs {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("alternate %s: %v", dir, err)
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("alternate %s: not a directory", dir)
+		}
+		alt, err := objectStorage(dir)
+		if err != nil {
+			return nil, fmt.Errorf("alternate %s: %v", dir, err)
+		}
+		a.alternates = append(a.alternates, alt)
+	}
+	return a, nil
+}
+
+func (a *alternateStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := a.Storer.EncodedObject(t, h)
+	if err != plumbing.ErrObjectNotFound {
+		return obj, err
+	}
+	for _, alt := range a.alternates {
+		if obj, err := alt.EncodedObject(t, h); err == nil {
+			return obj, nil
+		}
+	}
+	return nil, plumbing.ErrObjectNotFound
+}
+
+func (a *alternateStorer) HasEncodedObject(h plumbing.Hash) error {
+	err := a.Storer.HasEncodedObject(h)
+	if err != plumbing.ErrObjectNotFound {
+		return err
+	}
+	for _, alt := range a.alternates {
+		if alt.HasEncodedObject(h) == nil {
+			return nil
+		}
+	}
+	return plumbing.ErrObjectNotFound
+}
+
+func (a *alternateStorer) IterEncodedObjects(t plumbing.ObjectType) (storer.EncodedObjectIter, error) {
+	iter, err := a.Storer.IterEncodedObjects(t)
+	if err != nil {
+		return nil, err
+	}
+	iters := []storer.EncodedObjectIter{iter}
+	for _, alt := range a.alternates {
+		iter, err := alt.IterEncodedObjects(t)
+		if err != nil {
+			return nil, err
+		}
+		iters = append(iters, iter)
+	}
+	return storer.NewMultiEncodedObjectIter(iters), nil
+}
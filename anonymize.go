@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// anonymize replaces every object hash in the graph with a pseudonym, the
+// SHA-1 of the hash and a salt chosen at random for each run, and discards
+// the file names and commit authorship and messages recorded by the walk.
+// The pseudonyms are consistent within the graph, so its shape is preserved,
+// but cannot be traced back to the objects in the repository. Reference
+// names are kept.
+func (g *graph) anonymize() error {
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	pseudonyms := make(map[plumbing.Hash]plumbing.Hash)
+	anon := func(h plumbing.Hash) plumbing.Hash {
+		if p, ok := pseudonyms[h]; ok {
+			return p
+		}
+		d := sha1.New()
+		d.Write(salt)
+		d.Write(h[:])
+		var p plumbing.Hash
+		copy(p[:], d.Sum(nil))
+		pseudonyms[h] = p
+		return p
+	}
+	nodes := make(map[plumbing.Hash]objectType, len(g.nodes))
+	for h, t := range g.nodes {
+		nodes[anon(h)] = t
+	}
+	g.nodes = nodes
+	anonSet := func(set map[plumbing.Hash]bool) map[plumbing.Hash]bool {
+		out := make(map[plumbing.Hash]bool, len(set))
+		for h := range set {
+			out[anon(h)] = true
+		}
+		return out
+	}
+
+	g.mergeBases = anonSet(g.mergeBases)
+	g.selfRefs = anonSet(g.selfRefs)
+	g.shallow = anonSet(g.shallow)
+	g.highlighted = anonSet(g.highlighted)
+	g.dangling = anonSet(g.dangling)
+	g.packed = anonSet(g.packed)
+	decorations := make(map[plumbing.Hash][]string, len(g.decorations))
+	for h, ds := range g.decorations {
+		decorations[anon(h)] = ds
+	}
+	g.decorations = decorations
+	hidden := make(map[plumbing.Hash]int, len(g.hiddenParents))
+	for h, n := range g.hiddenParents {
+		hidden[anon(h)] = n
+	}
+	g.hiddenParents = hidden
+	stashes := make(map[plumbing.Hash]int, len(g.stashes))
+	for h, n := range g.stashes {
+		stashes[anon(h)] = n
+	}
+	g.stashes = stashes
+	gens := make(map[plumbing.Hash]int, len(g.graphGenerations))
+	for h, n := range g.graphGenerations {
+		gens[anon(h)] = n
+	}
+	g.graphGenerations = gens
+
+	// Dropping the labels can leave edges identical, so re-add them all.
+	edges := g.edges
+	g.edges = make(map[plumbing.Hash][]edge, len(edges))
+	g.edgeSet = make(map[edgeKey]bool)
+	for h, es := range edges {
+		for _, e := range es {
+			g.addEdge(anon(h), edge{target: anon(e.target), role: e.role})
+		}
+	}
+
+	entries := make(map[plumbing.Hash][]object.TreeEntry, len(g.entries))
+	for h, es := range g.entries {
+		var out []object.TreeEntry
+		for _, e := range es {
+			out = append(out, object.TreeEntry{Mode: e.Mode, Hash: anon(e.Hash)})
+		}
+		entries[anon(h)] = out
+	}
+	g.entries = entries
+	g.paths = make(map[plumbing.Hash][]string)
+	sizes := make(map[plumbing.Hash]int64, len(g.sizes))
+	for h, n := range g.sizes {
+		sizes[anon(h)] = n
+	}
+	g.sizes = sizes
+
+	// Commit dates are kept so time ordering still works, but names,
+	// email addresses and messages are dropped.
+	info := make(map[plumbing.Hash]commitInfo, len(g.info))
+	for h, ci := range g.info {
+		c := commitInfo{
+			author:    object.Signature{When: ci.author.When},
+			committer: object.Signature{When: ci.committer.When},
+			parents:   ci.parents,
+			changed:   ci.changed,
+		}
+		if !ci.firstParent.IsZero() {
+			c.firstParent = anon(ci.firstParent)
+		}
+		info[anon(h)] = c
+	}
+	g.info = info
+
+	for name, ref := range g.refs {
+		if ref.Type() == plumbing.HashReference {
+			g.refs[name] = plumbing.NewHashReference(ref.Name(), anon(ref.Hash()))
+		}
+	}
+	return nil
+}
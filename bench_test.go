@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+var benchCommits = flag.Int("bench-commits", 1000, "number of commits in the history generated for benchmarks")
+
+// newHistory generates a repository of n commits on main, each changing one
+// of a few hundred files spread over a few directories, with every tenth
+// merging a commit from a side branch and every hundredth tagged. A
+// commit-graph file is written for it.
+func newHistory(tb testing.TB, n int) *git.Repository {
+	tb.Helper()
+	f := newFixture(tb)
+	var s strings.Builder
+	for i := 1; i <= n; i++ {
+		branch := "refs/heads/main"
+		if i%10 == 9 {
+			branch = "refs/heads/side"
+		}
+		fmt.Fprintf(&s, "commit %s\nmark :%d\n", branch, i)
+		fmt.Fprintf(&s, "committer C O Mitter <committer@example.com> %d +0000\n", 1500000000+60*i)
+		msg := fmt.Sprintf("change %d", i)
+		fmt.Fprintf(&s, "data %d\n%s\n", len(msg), msg)
+		switch {
+		case i%10 == 0:
+			fmt.Fprintf(&s, "from :%d\nmerge :%d\n", i-2, i-1)
+		case i > 1:
+			fmt.Fprintf(&s, "from :%d\n", i-1)
+		}
+		content := fmt.Sprintf("version %d\n", i)
+		fmt.Fprintf(&s, "M 100644 inline dir%d/file%d\ndata %d\n%s\n", i%7, i%311, len(content), content)
+		if i%100 == 0 {
+			fmt.Fprintf(&s, "reset refs/tags/v%d\nfrom :%d\n\n", i/100, i)
+		}
+	}
+	f.gitInput(s.String(), "fast-import", "--quiet")
+	f.git("commit-graph", "write", "--reachable")
+	r, err := git.PlainOpen(f.dir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return r
+}
+
+// benchWalk walks r from every reference b.N times.
+func benchWalk(b *testing.B, r *git.Repository, opts *options) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g := newGraph(opts)
+		if err := g.populate(context.Background(), r, nil, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchRender walks r once and renders its graph b.N times.
+func benchRender(b *testing.B, r *git.Repository, opts *options) {
+	g := newGraph(opts)
+	if err := g.populate(context.Background(), r, nil, opts); err != nil {
+		b.Fatal(err)
+	}
+	g.filter(opts)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := renderers[opts.format](ioutil.Discard, g, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	benchWalk(b, newHistory(b, *benchCommits), testOptions())
+}
+
+func BenchmarkRender(b *testing.B) {
+	benchRender(b, newHistory(b, *benchCommits), testOptions())
+}
+
+// BenchmarkWalkCommitGraph compares a walk of only the commits that decodes
+// them with one that reads them from the commit-graph file.
+func BenchmarkWalkCommitGraph(b *testing.B) {
+	r := newHistory(b, *benchCommits)
+	for _, useCommitGraph := range []bool{false, true} {
+		b.Run(fmt.Sprintf("use-commit-graph=%v", useCommitGraph), func(b *testing.B) {
+			opts := testOptions()
+			opts.only = typeSet{commitType: true}
+			opts.useCommitGraph = useCommitGraph
+			benchWalk(b, r, opts)
+		})
+	}
+}
+
+// BenchmarkRenderHTMLLabels compares rendering the default labels with
+// rendering -html-labels.
+func BenchmarkRenderHTMLLabels(b *testing.B) {
+	r := newHistory(b, *benchCommits)
+	for _, htmlLabels := range []bool{false, true} {
+		b.Run(fmt.Sprintf("html-labels=%v", htmlLabels), func(b *testing.B) {
+			opts := testOptions()
+			opts.htmlLabels = htmlLabels
+			benchRender(b, r, opts)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// walkChanged adds the commit named n and its first parent to the graph,
+// along with only the trees and blobs of the commit that were added or
+// modified since the parent, less the blobs larger than
+// -exclude-blobs-larger-than. A root commit is compared with the empty tree,
+// so all of its objects are changed.
+func (g *graph) walkChanged(ctx context.Context, r *git.Repository, n string) error {
+	h, err := resolveCommit(r, n)
+	if err != nil {
+		return err
+	}
+	commit, err := object.GetCommit(r.Storer, h)
+	if err != nil {
+		return fmt.Errorf("walkChanged %s: %v", h, err)
+	}
+	g.roots[h] = true
+	g.requested[h] = true
+	g.addCommit(commit)
+	var from *object.Tree
+	if len(commit.ParentHashes) > 0 {
+		parent, err := object.GetCommit(r.Storer, commit.ParentHashes[0])
+		if err != nil {
+			return fmt.Errorf("walkChanged %s: %v", h, err)
+		}
+		g.addCommit(parent)
+		g.addEdge(h, edge{target: parent.Hash, role: commitParent})
+		if from, err = parent.Tree(); err != nil {
+			return fmt.Errorf("walkChanged %s: %v", h, err)
+		}
+	}
+	to, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("walkChanged %s: %v", h, err)
+	}
+	g.mark(treeType, to.Hash)
+	g.addEdge(h, edge{target: to.Hash, role: commitTree})
+
+	changes, err := object.DiffTreeContext(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("walkChanged %s: %v", h, err)
+	}
+	for _, c := range changes {
+		// Deleted files are in the parent only, and submodules are not
+		// in the repository.
+		if c.To.Name == "" || c.To.TreeEntry.Mode == filemode.Submodule {
+			continue
+		}
+		if g.excludedDir(c.To.Name) {
+			continue
+		}
+		skip, err := g.skipBlob(r.Storer, c.To.TreeEntry.Hash)
+		if err != nil {
+			return fmt.Errorf("walkChanged %s: %v", h, err)
+		}
+		if skip {
+			continue
+		}
+		if err := g.addChangedPath(to, c.To.Name, c.To.TreeEntry.Hash); err != nil {
+			return fmt.Errorf("walkChanged %s: %v", h, err)
+		}
+	}
+	return nil
+}
+
+// addCommit adds commit to the graph as a node without walking it.
+func (g *graph) addCommit(commit *object.Commit) {
+	g.mark(commitType, commit.Hash)
+	g.info[commit.Hash] = newCommitInfo(commit)
+}
+
+// addChangedPath adds the blob b at path p beneath root to the graph, along
+// with the trees leading down to it, which have changed along with it. Each
+// edge is labeled with the name of its entry.
+func (g *graph) addChangedPath(root *object.Tree, p string, b plumbing.Hash) error {
+	dir := root
+	names := strings.Split(p, "/")
+	for _, name := range names[:len(names)-1] {
+		sub, err := dir.Tree(name)
+		if err != nil {
+			return err
+		}
+		g.mark(treeType, sub.Hash)
+		g.addEdge(dir.Hash, edge{target: sub.Hash, role: treeEntry, label: name})
+		dir = sub
+	}
+	g.mark(blobType, b)
+	g.paths[b] = append(g.paths[b], p)
+	g.addEdge(dir.Hash, edge{target: b, role: treeEntry, label: names[len(names)-1]})
+	return nil
+}
+
+// resolveCommit returns the commit named by the reference or object n,
+// peeling any tags.
+func resolveCommit(r *git.Repository, n string) (plumbing.Hash, error) {
+	h, err := resolveObject(r, n)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for {
+		tag, err := object.GetTag(r.Storer, h)
+		if err != nil {
+			return h, nil
+		}
+		h = tag.Target
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// topDirs returns, for each tree and blob in the graph, the names of the
+// top-level directories it is reachable under, in name order, for
+// -cluster-by-dir. The walk records the paths of a shared subtree's entries
+// under the first path it is found at only, so the directories of each tree
+// are passed down to its entries as well. Root trees and the files at the top
+// level are under none.
+func (g *graph) topDirs() map[plumbing.Hash][]string {
+	dirs := make(map[plumbing.Hash]map[string]bool)
+	add := func(h plumbing.Hash, dir string) bool {
+		if dirs[h] == nil {
+			dirs[h] = make(map[string]bool)
+		}
+		if dirs[h][dir] {
+			return false
+		}
+		dirs[h][dir] = true
+		return true
+	}
+	var queue []plumbing.Hash
+	for h, t := range g.nodes {
+		if t != treeType && t != blobType {
+			continue
+		}
+		for _, p := range g.paths[h] {
+			dir := p
+			if i := strings.Index(p, "/"); i >= 0 {
+				dir = p[:i]
+			} else if t != treeType {
+				continue
+			}
+			add(h, dir)
+		}
+		if t == treeType && len(dirs[h]) > 0 {
+			queue = append(queue, h)
+		}
+	}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		for _, e := range g.edges[h] {
+			if e.role != treeEntry || !g.is(e.target, treeType) && !g.is(e.target, blobType) {
+				continue
+			}
+			changed := false
+			for dir := range dirs[h] {
+				if add(e.target, dir) {
+					changed = true
+				}
+			}
+			if changed && g.is(e.target, treeType) {
+				queue = append(queue, e.target)
+			}
+		}
+	}
+	out := make(map[plumbing.Hash][]string, len(dirs))
+	for h, set := range dirs {
+		for dir := range set {
+			out[h] = append(out[h], dir)
+		}
+		sort.Strings(out[h])
+	}
+	return out
+}
+
+// dirNote returns the label line noting the other top-level directories an
+// object placed in the cluster of the first of dirs is also under, or "".
+func dirNote(dirs []string) string {
+	if len(dirs) < 2 {
+		return ""
+	}
+	return "\\n" + escapeLabel("(also under "+strings.Join(dirs[1:], ", ")+")")
+}
+
+// renderDirClusters groups the trees and blobs into a cluster for each
+// top-level directory they are under. An object under several is placed in
+// the cluster of the first by name, and its label notes the others. Objects
+// drawn inside a tree's record with -tree-as-record are left out.
+func renderDirClusters(w io.Writer, g *graph, dirs map[plumbing.Hash][]string, inline map[plumbing.Hash]bool, opts *options) {
+	clusters := make(map[string][]plumbing.Hash)
+	for h, ds := range dirs {
+		if !inline[h] {
+			clusters[ds[0]] = append(clusters[ds[0]], h)
+		}
+	}
+	var names []string
+	for name := range clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		hs := clusters[name]
+		sortHashes(hs)
+		fmt.Fprintf(w, "\tsubgraph \"cluster_dir_%d\" {\n", i)
+		attrs := map[string]string{"label": escapeLabel(name + "/"), "style": "dashed"}
+		if !opts.noColor {
+			attrs["color"] = palette["tree"]
+		}
+		fmt.Fprintf(w, "\t\tgraph %s;\n", renderAttrs(attrs))
+		for _, h := range hs {
+			fmt.Fprintf(w, "\t\t%s;\n", dotID(h.String()))
+		}
+		fmt.Fprintln(w, "\t}")
+	}
+}
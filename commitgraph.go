@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+// commitGraph is a commit-graph file, as written by git commit-graph write,
+// which holds the tree, parents, generation number and commit time of each
+// commit in it. go-git cannot read it, so it is parsed here. Only a single
+// file in objects/info is read; a split chain of commit-graph files is not.
+type commitGraph struct {
+	fanout []byte // OIDF: 256 cumulative counts of commits by first byte
+	oids   []byte // OIDL: the sorted hashes of the commits
+	data   []byte // CDAT: tree, parents, generation and time, per commit
+	extra  []byte // EDGE: the parents of octopus merges beyond the first
+	n      int
+}
+
+// commitGraphEntry is what a commit-graph file records about a commit.
+type commitGraphEntry struct {
+	tree    plumbing.Hash
+	parents []plumbing.Hash
+
+	// generation is the commit's generation number, 1 for a root commit
+	// and one more than the largest of its parents' otherwise, or 0 if the
+	// file was written without them.
+	generation uint32
+	when       time.Time
+}
+
+const (
+	commitGraphNoParent   = 0x70000000
+	commitGraphExtraEdges = 0x80000000
+	commitGraphLastEdge   = 0x80000000
+)
+
+// readCommitGraph reads the commit-graph file of the object directory fs. It
+// returns nil, without an error, when there is none.
+func readCommitGraph(fs billy.Filesystem) (*commitGraph, error) {
+	f, err := fs.Open(fs.Join("info", "commit-graph"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return parseCommitGraph(b)
+}
+
+func parseCommitGraph(b []byte) (*commitGraph, error) {
+	if len(b) < 8 || string(b[:4]) != "CGPH" {
+		return nil, fmt.Errorf("commit-graph: bad signature")
+	}
+	if b[4] != 1 {
+		return nil, fmt.Errorf("commit-graph: unsupported version %d", b[4])
+	}
+	if b[5] != 1 {
+		return nil, fmt.Errorf("commit-graph: unsupported hash version %d", b[5])
+	}
+	chunks := int(b[6])
+	if len(b) < 8+(chunks+1)*12 {
+		return nil, fmt.Errorf("commit-graph: truncated chunk table")
+	}
+	c := &commitGraph{}
+	for i := 0; i < chunks; i++ {
+		e := b[8+i*12:]
+		start := binary.BigEndian.Uint64(e[4:12])
+		end := binary.BigEndian.Uint64(e[16:24])
+		if start > end || end > uint64(len(b)) {
+			return nil, fmt.Errorf("commit-graph: bad offset for chunk %q", e[:4])
+		}
+		chunk := b[start:end]
+		switch string(e[:4]) {
+		case "OIDF":
+			c.fanout = chunk
+		case "OIDL":
+			c.oids = chunk
+		case "CDAT":
+			c.data = chunk
+		case "EDGE":
+			c.extra = chunk
+		}
+	}
+	if len(c.fanout) != 256*4 {
+		return nil, fmt.Errorf("commit-graph: missing or bad OIDF chunk")
+	}
+	c.n = int(binary.BigEndian.Uint32(c.fanout[255*4:]))
+	if len(c.oids) != c.n*20 || len(c.data) != c.n*36 {
+		return nil, fmt.Errorf("commit-graph: missing or bad OIDL or CDAT chunk")
+	}
+	return c, nil
+}
+
+// position returns the index of the commit h in the file.
+func (c *commitGraph) position(h plumbing.Hash) (int, bool) {
+	lo := 0
+	if h[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(c.fanout[(int(h[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(c.fanout[int(h[0])*4:]))
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch bytes.Compare(c.oids[mid*20:mid*20+20], h[:]) {
+		case 0:
+			return mid, true
+		case -1:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false
+}
+
+func (c *commitGraph) hash(i uint32) (plumbing.Hash, error) {
+	var h plumbing.Hash
+	if int(i) >= c.n {
+		return h, fmt.Errorf("commit-graph: bad parent position %d", i)
+	}
+	copy(h[:], c.oids[i*20:])
+	return h, nil
+}
+
+// commit returns what the file records about the commit h, or false if it is
+// not in the file.
+func (c *commitGraph) commit(h plumbing.Hash) (commitGraphEntry, bool, error) {
+	var e commitGraphEntry
+	i, ok := c.position(h)
+	if !ok {
+		return e, false, nil
+	}
+	d := c.data[i*36 : i*36+36]
+	copy(e.tree[:], d[:20])
+	for j, p := range []uint32{binary.BigEndian.Uint32(d[20:]), binary.BigEndian.Uint32(d[24:])} {
+		switch {
+		case p == commitGraphNoParent:
+		case j == 1 && p&commitGraphExtraEdges != 0:
+			for k := int(p &^ commitGraphExtraEdges); ; k++ {
+				if (k+1)*4 > len(c.extra) {
+					return e, false, fmt.Errorf("commit-graph: bad EDGE position for %s", h)
+				}
+				q := binary.BigEndian.Uint32(c.extra[k*4:])
+				ph, err := c.hash(q &^ commitGraphLastEdge)
+				if err != nil {
+					return e, false, err
+				}
+				e.parents = append(e.parents, ph)
+				if q&commitGraphLastEdge != 0 {
+					break
+				}
+			}
+		default:
+			ph, err := c.hash(p)
+			if err != nil {
+				return e, false, err
+			}
+			e.parents = append(e.parents, ph)
+		}
+	}
+	e.generation = binary.BigEndian.Uint32(d[28:]) >> 2
+	secs := int64(binary.BigEndian.Uint32(d[28:])&3)<<32 | int64(binary.BigEndian.Uint32(d[32:]))
+	e.when = time.Unix(secs, 0)
+	return e, true, nil
+}
+
+// objectsDir returns the object directory of the repository behind s, or
+// false if its objects are not stored in a directory.
+func objectsDir(s storage.Storer) (billy.Filesystem, bool) {
+	if a, ok := s.(*alternateStorer); ok {
+		s = a.Storer
+	}
+	if o, ok := s.(*objectDirStorer); ok {
+		return osfs.New(o.dir), true
+	}
+	fs, ok := sharedGitDir(s)
+	if !ok {
+		return nil, false
+	}
+	objects, err := fs.Chroot("objects")
+	if err != nil {
+		return nil, false
+	}
+	return objects, true
+}
+
+// loadCommitGraph reads the commit-graph file of the repository for
+// -use-commit-graph and -rank-by-generation. Without one, commits are
+// decoded as usual and not ranked.
+func (g *graph) loadCommitGraph(r *git.Repository) error {
+	fs, ok := objectsDir(r.Storer)
+	if !ok {
+		infof("no commit-graph: objects are not in a directory")
+		return nil
+	}
+	c, err := readCommitGraph(fs)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		infof("no commit-graph: decoding commits")
+		return nil
+	}
+	infof("commit-graph with %d commits", c.n)
+	g.commitGraph = c
+	return nil
+}
+
+// parentsOnly reports whether the walk needs no more of each commit than the
+// commit-graph file records: only commits and tags are kept with -only, so
+// trees are not walked, and nothing drawn needs the authorship, message or
+// changes of a commit.
+func (g *graph) parentsOnly() bool {
+	opts := g.opts
+	if len(opts.only) == 0 || opts.only[treeType] || opts.only[blobType] || opts.only[missingType] {
+		return false
+	}
+	return opts.labelTemplate == nil && !opts.colorByEmailDomain && !opts.scalePenwidth &&
+		!opts.followRenames && opts.stats == "" && !opts.htmlLabels && opts.format != "text-tree"
+}
+
+// graphCommit returns the commit h as recorded in the commit-graph file,
+// without decoding it, when -use-commit-graph is given and the walk only
+// needs its parents. Only its tree, parents and commit time are set.
+func (g *graph) graphCommit(h plumbing.Hash) (*object.Commit, bool, error) {
+	if !g.opts.useCommitGraph || g.commitGraph == nil || !g.parentsOnly() {
+		return nil, false, nil
+	}
+	e, ok, err := g.commitGraph.commit(h)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return &object.Commit{
+		Hash:         h,
+		TreeHash:     e.tree,
+		ParentHashes: e.parents,
+		Committer:    object.Signature{When: e.when},
+	}, true, nil
+}
+
+// recordGeneration records the generation number of the commit h from the
+// commit-graph file for -rank-by-generation. Files written without
+// generation numbers store 0, which is not recorded.
+func (g *graph) recordGeneration(h plumbing.Hash) error {
+	if !g.opts.rankByGeneration || g.commitGraph == nil {
+		return nil
+	}
+	e, ok, err := g.commitGraph.commit(h)
+	if err != nil {
+		return err
+	}
+	if ok && e.generation > 0 {
+		g.graphGenerations[h] = int(e.generation)
+	}
+	return nil
+}
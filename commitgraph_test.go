@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// TestUseCommitGraph checks that the commits read from a commit-graph file
+// written by git, including an octopus merge whose parents spill into its
+// extra edges chunk, are those the objects themselves describe.
+func TestUseCommitGraph(t *testing.T) {
+	f := newFixture(t)
+	f.write("file", "root\n")
+	root := f.commit("root")
+	var tips []string
+	for _, b := range []string{"a", "b", "c", "d"} {
+		f.git("checkout", "-q", "-b", b, root)
+		f.write("file", b+"\n")
+		tips = append(tips, f.commit(b))
+	}
+	octopus := f.commitTree("octopus", tips...)
+	f.git("checkout", "-q", "-b", "e", root)
+	e := f.commit("e")
+	merge := f.commitTree("merge", octopus, e)
+	f.git("update-ref", "refs/heads/main", merge)
+	f.git("commit-graph", "write", "--reachable")
+
+	decoded := testOptions()
+	decoded.only = typeSet{commitType: true}
+	want := f.render(decoded)
+	opts := testOptions()
+	opts.only = typeSet{commitType: true}
+	opts.useCommitGraph = true
+	if got := f.render(opts); got != want {
+		t.Errorf("with -use-commit-graph got\n%s\nwant\n%s", got, want)
+	}
+
+	r, err := git.PlainOpen(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newGraph(opts)
+	if err := g.populate(context.Background(), r, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if g.commitGraph == nil {
+		t.Fatal("commit-graph file not loaded")
+	}
+	for _, h := range g.hashes(commitType) {
+		entry, ok, err := g.commitGraph.commit(h)
+		if err != nil || !ok {
+			t.Fatalf("commit %s not read from the commit-graph file: %v", h, err)
+		}
+		var parents []string
+		for _, p := range entry.parents {
+			parents = append(parents, p.String())
+		}
+		wantParents := strings.Fields(f.git("rev-list", "--parents", "-n", "1", h.String()))[1:]
+		if got, want := strings.Join(parents, " "), strings.Join(wantParents, " "); got != want {
+			t.Errorf("parents of %s = %s, want %s", h, got, want)
+		}
+		if tree := plumbing.NewHash(f.git("rev-parse", h.String()+"^{tree}")); entry.tree != tree {
+			t.Errorf("tree of %s = %s, want %s", h, entry.tree, tree)
+		}
+	}
+	if len(g.edges[plumbing.NewHash(octopus)]) != len(tips) {
+		t.Errorf("octopus merge has %d parent edges, want %d", len(g.edges[plumbing.NewHash(octopus)]), len(tips))
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// commonDirStorer is the storage.Storer of a linked worktree. Objects,
+// configuration and shared references are read from the common directory of
+// the main repository, while HEAD, the index and the other per-worktree
+// references are read from the worktree's own git directory.
+type commonDirStorer struct {
+	storage.Storer
+	local *filesystem.Storage
+}
+
+// withCommonDir returns r reading from its common directory when it is a
+// linked worktree, as named by GIT_COMMON_DIR or by the commondir file in its
+// git directory. Other repositories are returned unchanged.
+func withCommonDir(r *git.Repository) (*git.Repository, error) {
+	local, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return r, nil
+	}
+	gitdir := local.Filesystem().Root()
+	common := os.Getenv("GIT_COMMON_DIR")
+	if common == "" {
+		b, err := ioutil.ReadFile(filepath.Join(gitdir, "commondir"))
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		common = strings.TrimSpace(string(b))
+	}
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(gitdir, common)
+	}
+	s, err := filesystem.NewStorage(osfs.New(common))
+	if err != nil {
+		return nil, err
+	}
+	r.Storer = &commonDirStorer{Storer: s, local: local}
+	return r, nil
+}
+
+// perWorktree reports whether the reference name belongs to a single
+// worktree rather than being shared by all of them: the pseudo-references
+// outside refs/, such as HEAD, and those under refs/bisect/, refs/worktree/
+// and refs/rewritten/.
+func perWorktree(name plumbing.ReferenceName) bool {
+	n := string(name)
+	return !strings.HasPrefix(n, "refs/") ||
+		strings.HasPrefix(n, "refs/bisect/") ||
+		strings.HasPrefix(n, "refs/worktree/") ||
+		strings.HasPrefix(n, "refs/rewritten/")
+}
+
+// refs returns the store holding the reference name.
+func (c *commonDirStorer) refs(name plumbing.ReferenceName) storer.ReferenceStorer {
+	if perWorktree(name) {
+		return c.local
+	}
+	return c.Storer
+}
+
+func (c *commonDirStorer) Reference(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	return c.refs(name).Reference(name)
+}
+
+func (c *commonDirStorer) SetReference(ref *plumbing.Reference) error {
+	return c.refs(ref.Name()).SetReference(ref)
+}
+
+func (c *commonDirStorer) CheckAndSetReference(new, old *plumbing.Reference) error {
+	return c.refs(new.Name()).CheckAndSetReference(new, old)
+}
+
+func (c *commonDirStorer) RemoveReference(name plumbing.ReferenceName) error {
+	return c.refs(name).RemoveReference(name)
+}
+
+// IterReferences iterates over the shared references of the common
+// directory, whose own HEAD belongs to the main worktree and is left out,
+// followed by the per-worktree references of this one.
+func (c *commonDirStorer) IterReferences() (storer.ReferenceIter, error) {
+	var refs []*plumbing.Reference
+	for _, s := range []storer.ReferenceStorer{c.Storer, c.local} {
+		iter, err := s.IterReferences()
+		if err != nil {
+			return nil, err
+		}
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			if c.refs(ref.Name()) == s {
+				refs = append(refs, ref)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return storer.NewReferenceSliceIter(refs), nil
+}
+
+func (c *commonDirStorer) Index() (*index.Index, error) {
+	return c.local.Index()
+}
+
+func (c *commonDirStorer) SetIndex(idx *index.Index) error {
+	return c.local.SetIndex(idx)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// renderD2 writes the graph as a D2 diagram, with objects as ovals,
+// references as rectangles and edges as connections between them.
+func renderD2(out io.Writer, g *graph, opts *options) error {
+	w := bufio.NewWriter(out)
+	if l := graphLabel(g, opts); l != "" {
+		fmt.Fprintf(w, "title: %s {\n\tshape: text\n\tnear: top-center\n}\n", d2String(l))
+	}
+	for _, set := range g.objectSets() {
+		for _, h := range set.hashes {
+			renderD2Node(w, h.String(), g.decoratedLabel(h, set.typ.String(), opts), "oval", set.typ.String(), opts)
+		}
+	}
+	names := sortedRefNames(g.refs)
+	for _, name := range names {
+		renderD2Node(w, name, escapeLabel(name), "rectangle", "ref", opts)
+	}
+	for _, name := range names {
+		if target, ok := g.refTarget(name); ok {
+			fmt.Fprintf(w, "%s -> %s\n", d2Key(name), d2Key(target))
+		}
+	}
+	for _, h := range sortedEdgeSources(g.edges) {
+		for _, e := range g.edges[h] {
+			fmt.Fprintf(w, "%s -> %s", d2Key(h.String()), d2Key(e.target.String()))
+			if e.label != "" {
+				fmt.Fprintf(w, ": %s", d2String(escapeLabel(e.label)))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	return w.Flush()
+}
+
+func renderD2Node(w io.Writer, key, label, shape, typ string, opts *options) {
+	fmt.Fprintf(w, "%s: %s {\n\tshape: %s\n", d2Key(key), d2String(label), shape)
+	if !opts.noColor {
+		fmt.Fprintf(w, "\tstyle.fill: %s\n", palette[typ])
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// d2Bare matches the keys that D2 accepts without quoting.
+var d2Bare = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// d2Key returns s as a D2 key, quoted unless it is made up only of letters,
+// digits and underscores. Unquoted, characters such as '.' and '/' would be
+// read as nesting or as part of the syntax.
+func d2Key(s string) string {
+	if d2Bare.MatchString(s) {
+		return s
+	}
+	return d2String(escapeLabel(s))
+}
+
+// d2String returns s, which must already be escaped by escapeLabel, as a
+// double-quoted D2 string. D2 uses the same escapes as DOT.
+func d2String(s string) string {
+	return `"` + s + `"`
+}
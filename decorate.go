@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// refDecorations maps each object that a reference points at directly to the
+// short names of those references, in the style of git log --decorate. A
+// symbolic reference to one of them is shown as "HEAD -> main".
+func (g *graph) refDecorations() map[plumbing.Hash][]string {
+	pointedBy := make(map[string]string)
+	for _, name := range sortedRefNames(g.refs) {
+		ref := g.refs[name]
+		if ref.Type() != plumbing.SymbolicReference {
+			continue
+		}
+		target := ref.Target().String()
+		if _, ok := pointedBy[target]; !ok {
+			pointedBy[target] = name
+		}
+	}
+	decorations := make(map[plumbing.Hash][]string)
+	for _, name := range sortedRefNames(g.refs) {
+		ref := g.refs[name]
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		d := shortRefName(name)
+		if s, ok := pointedBy[name]; ok {
+			d = s + " -> " + d
+		}
+		decorations[ref.Hash()] = append(decorations[ref.Hash()], d)
+	}
+	return decorations
+}
+
+// shortRefName abbreviates a reference name the way git log --decorate does.
+func shortRefName(name string) string {
+	switch {
+	case strings.HasPrefix(name, "refs/heads/"):
+		return strings.TrimPrefix(name, "refs/heads/")
+	case strings.HasPrefix(name, "refs/tags/"):
+		return "tag: " + strings.TrimPrefix(name, "refs/tags/")
+	case strings.HasPrefix(name, "refs/remotes/"):
+		return strings.TrimPrefix(name, "refs/remotes/")
+	}
+	return name
+}
+
+// decoratedLabel returns the label of the object h of type t, followed by the
+// names of the references pointing at it when -decorate is used.
+func (g *graph) decoratedLabel(h plumbing.Hash, t string, opts *options) string {
+	l := g.nodeLabel(h, t, opts)
+	if ds, ok := g.decorations[h]; ok {
+		l += "\\n" + escapeLabel(wrapText("("+strings.Join(ds, ", ")+")", opts.labelWrap))
+	}
+	return l
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// A fileChange is a file that differs between two trees. from is the zero
+// hash if the file was added, and to if it was removed.
+type fileChange struct {
+	path     string
+	from, to plumbing.Hash
+}
+
+// diffFiles calls fn, in path order, for each file added, removed or
+// modified between the trees a and b beneath prefix, either of which may be
+// the zero hash for an empty tree. A file replaced by a directory, or the
+// other way around, is removed or added along with the files of the
+// directory. Subtrees with the same hash on both sides are skipped without
+// being read, which makes this much cheaper than object.DiffTree.
+func diffFiles(ctx context.Context, s storer.EncodedObjectStorer, a, b plumbing.Hash, prefix string, fn func(fileChange)) error {
+	if a == b {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	as, err := treeEntries(s, a)
+	if err != nil {
+		return err
+	}
+	bs, err := treeEntries(s, b)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range as {
+		names = append(names, name)
+	}
+	for name := range bs {
+		if _, ok := as[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ea, inA := as[name]
+		eb, inB := bs[name]
+		if inA && inB && ea.Hash == eb.Hash && ea.Mode == eb.Mode {
+			continue
+		}
+		p := path.Join(prefix, name)
+		aDir, bDir := inA && ea.Mode == filemode.Dir, inB && eb.Mode == filemode.Dir
+		if inA && !aDir || inB && !bDir {
+			c := fileChange{path: p}
+			if inA && !aDir {
+				c.from = ea.Hash
+			}
+			if inB && !bDir {
+				c.to = eb.Hash
+			}
+			fn(c)
+		}
+		if !aDir && !bDir {
+			continue
+		}
+		var ta, tb plumbing.Hash
+		if aDir {
+			ta = ea.Hash
+		}
+		if bDir {
+			tb = eb.Hash
+		}
+		if err := diffFiles(ctx, s, ta, tb, p, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeEntries returns the entries of the tree h by name, or none for the
+// zero hash.
+func treeEntries(s storer.EncodedObjectStorer, h plumbing.Hash) (map[string]object.TreeEntry, error) {
+	m := make(map[string]object.TreeEntry)
+	if h.IsZero() {
+		return m, nil
+	}
+	t, err := object.GetTree(s, h)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range t.Entries {
+		m[e.Name] = e
+	}
+	return m, nil
+}
@@ -0,0 +1,696 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func renderDOT(out io.Writer, g *graph, opts *options) error {
+	w := bufio.NewWriter(out)
+	renderProvenance(w, opts)
+	g.near = g.nearHighlights()
+	if opts.strict {
+		fmt.Fprint(w, "strict ")
+	}
+	fmt.Fprintln(w, "digraph {")
+	graphAttrs := make(map[string]string)
+	if l := graphLabel(g, opts); l != "" {
+		graphAttrs["label"] = l
+		graphAttrs["labelloc"] = "t"
+	}
+	if opts.bundleEdges {
+		graphAttrs["concentrate"] = "true"
+	}
+	if opts.splines != "" {
+		graphAttrs["splines"] = opts.splines
+	}
+	if opts.nodesep > 0 {
+		graphAttrs["nodesep"] = strconv.FormatFloat(opts.nodesep, 'g', -1, 64)
+	}
+	if opts.ranksep > 0 {
+		graphAttrs["ranksep"] = strconv.FormatFloat(opts.ranksep, 'g', -1, 64)
+	}
+	setAttrs(graphAttrs, opts.graphAttrs)
+	if len(graphAttrs) > 0 {
+		fmt.Fprintf(w, "\tgraph %s;\n", renderAttrs(graphAttrs))
+	}
+	nodeAttrs := map[string]string{"fontname": "AnonymousPro"}
+	if !opts.noColor {
+		nodeAttrs["style"] = "filled"
+	}
+	setAttrs(nodeAttrs, opts.nodeAttrs)
+	fmt.Fprintf(w, "\tnode %s;\n", renderAttrs(nodeAttrs))
+	if len(opts.edgeAttrs) > 0 {
+		edgeAttrs := make(map[string]string)
+		setAttrs(edgeAttrs, opts.edgeAttrs)
+		fmt.Fprintf(w, "\tedge %s;\n", renderAttrs(edgeAttrs))
+	}
+	for _, h := range g.hashes(tagType) {
+		attrs := map[string]string{
+			"label": g.decoratedLabel(h, "tag", opts),
+		}
+		if !opts.noColor {
+			attrs["color"] = palette["tag"]
+		}
+		g.renderNode(w, h, tagType, attrs, opts)
+	}
+	var branchColors, commitColors map[string]string
+	if opts.colorizeByRef {
+		branchColors, commitColors = g.branchColors()
+	}
+	var domainColors map[plumbing.Hash]string
+	if opts.colorByEmailDomain && !opts.noColor {
+		domainColors = g.domainColors()
+	}
+	commits := g.hashes(commitType)
+	g.sortCommits(commits, opts.sortCommitsBy)
+	for _, h := range commits {
+		attrs := map[string]string{
+			"group": "commits",
+			"label": g.decoratedLabel(h, "commit", opts),
+		}
+		if !opts.noColor {
+			attrs["color"] = palette["commit"]
+			if c, ok := commitColors[h.String()]; ok {
+				attrs["color"] = c
+			}
+			if c, ok := domainColors[h]; ok {
+				attrs["color"] = c
+			}
+		}
+		if n, ok := g.stashes[h]; ok {
+			attrs["shape"] = "folder"
+			attrs["label"] += fmt.Sprintf("\\nstash@{%d}", n)
+			if !opts.noColor {
+				attrs["color"] = palette["stash"]
+			}
+		}
+		if g.shallowBoundary(h) {
+			// The parents were cut off by a shallow clone.
+			attrs["label"] += "\\n(shallow)"
+			attrs["style"] = "dashed"
+			if !opts.noColor {
+				attrs["style"] = "filled,dashed"
+			}
+		}
+		if g.dangling[h] {
+			// Reachable from no reference, found by -fsck.
+			attrs["label"] += "\\n(dangling)"
+			attrs["style"] = "dotted"
+			if !opts.noColor {
+				attrs["style"] = "filled,dotted"
+			}
+		}
+		if g.info[h].parents == 0 {
+			// Root commits are where history begins.
+			attrs["peripheries"] = "2"
+		}
+		if n := g.hiddenParents[h]; n == 1 {
+			attrs["label"] += "\\n+1 more parent"
+		} else if n > 1 {
+			attrs["label"] += fmt.Sprintf("\\n+%d more parents", n)
+		}
+		if g.mergeBases[h] {
+			attrs["peripheries"] = "2"
+			attrs["penwidth"] = "2"
+		}
+		if ci, ok := g.info[h]; ok && opts.scalePenwidth && ci.changed >= 0 {
+			attrs["penwidth"] = fmt.Sprintf("%.1f", scaledPenwidth(float64(ci.changed)))
+		}
+		g.renderNode(w, h, commitType, attrs, opts)
+	}
+	if opts.topoOrder {
+		renderRanks(w, g, g.generations(), opts)
+	}
+	if opts.rankByGeneration {
+		if len(g.graphGenerations) == 0 {
+			infof("no generation numbers in a commit-graph: not ranking commits")
+		} else {
+			renderRanks(w, g, g.graphGenerations, opts)
+		}
+	}
+	if opts.alignSiblings {
+		renderSiblings(w, g)
+	}
+	if opts.clusterByRef {
+		renderBranchClusters(w, g, opts)
+	}
+	var dirs map[plumbing.Hash][]string
+	if opts.clusterByDir {
+		dirs = g.topDirs()
+	}
+	for _, h := range g.hashes(treeType) {
+		attrs := map[string]string{
+			"label": g.nodeLabel(h, "tree", opts) + dirNote(dirs[h]),
+		}
+		if !opts.noColor {
+			attrs["color"] = palette["tree"]
+		}
+		if opts.treeAsRecord {
+			attrs["shape"] = "record"
+			attrs["label"] = g.recordLabel(h, opts)
+		}
+		g.renderNode(w, h, treeType, attrs, opts)
+	}
+	var extColors map[string]string
+	if opts.byExtension {
+		extColors = extensionColors(g)
+	}
+	var inline map[plumbing.Hash]bool
+	if opts.treeAsRecord {
+		inline = g.inlineBlobs()
+	}
+	for _, h := range g.hashes(blobType) {
+		if inline[h] {
+			continue
+		}
+		attrs := map[string]string{
+			"label": g.nodeLabel(h, "blob", opts) + dirNote(dirs[h]),
+		}
+		if !opts.noColor {
+			attrs["color"] = palette["blob"]
+		}
+		if opts.byExtension {
+			ext := g.extension(h)
+			attrs["label"] = g.nodeLabel(h, "blob "+escapeLabel(ext), opts) + dirNote(dirs[h])
+			if !opts.noColor {
+				attrs["color"] = extColors[ext]
+			}
+		}
+		if n, ok := g.sizes[h]; ok && opts.scalePenwidth {
+			attrs["penwidth"] = fmt.Sprintf("%.1f", scaledPenwidth(float64(n)/1024))
+		}
+		g.renderNode(w, h, blobType, attrs, opts)
+	}
+	if opts.clusterByDir {
+		renderDirClusters(w, g, dirs, inline, opts)
+	}
+	for _, h := range g.hashes(missingType) {
+		attrs := map[string]string{
+			"label": g.nodeLabel(h, "missing", opts),
+			"style": "dashed",
+		}
+		if !opts.noColor {
+			attrs["color"] = palette["missing"]
+		}
+		g.renderNode(w, h, missingType, attrs, opts)
+	}
+	for _, h := range g.hashes(corruptType) {
+		attrs := map[string]string{
+			"label": g.nodeLabel(h, "corrupt", opts),
+			"shape": "octagon",
+		}
+		if !opts.noColor {
+			attrs["color"] = palette["corrupt"]
+		}
+		g.renderNode(w, h, corruptType, attrs, opts)
+	}
+	for _, name := range sortedRefNames(g.refs) {
+		attrs := map[string]string{"shape": "box"}
+		if opts.typeComments {
+			attrs["comment"] = "ref"
+		}
+		if l := wrapText(name, opts.labelWrap); l != name {
+			attrs["label"] = escapeLabel(l)
+		}
+		kind := "ref"
+		if opts.refKindColors {
+			kind = refKind(name)
+			if opts.noColor {
+				attrs["shape"] = refShapes[kind]
+			}
+		}
+		if !opts.noColor {
+			attrs["color"] = palette[kind]
+			if c, ok := branchColors[name]; ok {
+				attrs["color"] = c
+			}
+		}
+		emphasize(attrs, false, g.near != nil && !g.near[name], opts)
+		fmt.Fprintf(w, "\t%s %s;\n", dotID(name), renderAttrs(attrs))
+		target, ok := g.refTarget(name)
+		if !ok {
+			continue
+		}
+		edgeAttrs := make(map[string]string)
+		if g.near != nil && !(g.near[name] && g.near[target]) {
+			dimEdge(edgeAttrs)
+		}
+		if opts.refEdgeStyle {
+			// Keep references from pulling their targets out of the
+			// commit column.
+			edgeAttrs["style"] = "dashed"
+			edgeAttrs["constraint"] = "false"
+			if c, ok := attrs["color"]; ok {
+				edgeAttrs["color"] = c
+			}
+		}
+		if opts.arrowheads {
+			edgeAttrs["arrowhead"] = refArrowhead
+		}
+		if len(edgeAttrs) == 0 {
+			fmt.Fprintf(w, "\t%s -> %s;\n", dotID(name), dotID(target))
+			continue
+		}
+		fmt.Fprintf(w, "\t%s -> %s %s;\n", dotID(name), dotID(target), renderAttrs(edgeAttrs))
+	}
+	var ageColors map[plumbing.Hash]string
+	if opts.colorEdgesByAge && !opts.noColor {
+		ageColors = g.ageColors()
+	}
+	for _, h := range sortedEdgeSources(g.edges) {
+		for _, e := range g.edges[h] {
+			source := dotID(h.String())
+			attrs := make(map[string]string)
+			if c, ok := ageColors[h]; ok && e.role == commitParent {
+				attrs["color"] = c
+			}
+			if opts.mainlineWeight > 0 && e.role == commitParent && e.target == g.info[h].firstParent {
+				attrs["weight"] = strconv.Itoa(opts.mainlineWeight)
+			}
+			if e.label != "" {
+				attrs["label"] = escapeLabel(e.label)
+			}
+			if opts.treeAsRecord && e.role == treeEntry && g.is(h, treeType) {
+				if inline[e.target] {
+					continue
+				}
+				// The entry names are already fields of the record.
+				delete(attrs, "label")
+				if i := g.entryIndex(h, e.target); i >= 0 {
+					source += ":" + entryPort(i)
+				}
+			}
+			if opts.arrowheads {
+				attrs["arrowhead"] = arrowheads[e.role]
+			}
+			if g.near != nil && !(g.near[h.String()] && g.near[e.target.String()]) {
+				dimEdge(attrs)
+			}
+			if len(attrs) == 0 {
+				fmt.Fprintf(w, "\t%s -> %s;\n", source, dotID(e.target.String()))
+				continue
+			}
+			fmt.Fprintf(w, "\t%s -> %s %s;\n", source, dotID(e.target.String()), renderAttrs(attrs))
+		}
+	}
+	fmt.Fprintln(w, "}")
+	return w.Flush()
+}
+
+// splineStyles are the values Graphviz accepts for the splines attribute.
+var splineStyles = map[string]bool{
+	"none":     true,
+	"line":     true,
+	"false":    true,
+	"polyline": true,
+	"curved":   true,
+	"ortho":    true,
+	"spline":   true,
+	"true":     true,
+}
+
+// arrowheads is the arrowhead drawn with -arrowheads for each role of edge,
+// so the kind of link can be told apart without color. refArrowhead is drawn
+// on reference edges.
+var arrowheads = map[edgeRole]string{
+	tagTarget:    "vee",
+	commitParent: "normal",
+	commitTree:   "dot",
+	treeEntry:    "dot",
+}
+
+const refArrowhead = "empty"
+
+// refKind returns the palette entry for the reference name under
+// -color-refs-by-kind, chosen by the prefix of the name.
+func refKind(name string) string {
+	switch {
+	case name == "HEAD":
+		return "ref.head"
+	case strings.HasPrefix(name, "refs/heads/"):
+		return "ref.branch"
+	case strings.HasPrefix(name, "refs/tags/"):
+		return "ref.tag"
+	case strings.HasPrefix(name, "refs/remotes/"):
+		return "ref.remote"
+	case strings.HasPrefix(name, "refs/notes/"), name == "refs/stash":
+		return "ref.note"
+	}
+	return "ref"
+}
+
+// refShapes tells the kinds of reference apart by shape when
+// -color-refs-by-kind is used with -no-color.
+var refShapes = map[string]string{
+	"ref":        "box",
+	"ref.head":   "doubleoctagon",
+	"ref.branch": "box",
+	"ref.tag":    "cds",
+	"ref.remote": "folder",
+	"ref.note":   "note",
+}
+
+// extensionPalette is cycled through to color blobs by file extension.
+var extensionPalette = []string{
+	"gold", "orange", "khaki", "lightsalmon", "wheat",
+	"palegreen", "lightpink", "thistle", "burlywood", "lightcyan",
+}
+
+// branchPalette is cycled through to color branches with -colorize-by-ref.
+var branchPalette = []string{
+	"lightcoral", "mediumaquamarine", "orchid", "goldenrod", "cornflowerblue",
+	"darkseagreen", "sandybrown", "mediumpurple", "palevioletred", "cadetblue",
+}
+
+// renderBranchClusters groups the commits reachable from only one branch into
+// a cluster labeled with the branch name. Commits reachable from several
+// branches, or from none, are left outside every cluster.
+func renderBranchClusters(w io.Writer, g *graph, opts *options) {
+	reach := make(map[plumbing.Hash]int)
+	owner := make(map[plumbing.Hash]string)
+	for _, name := range sortedRefNames(g.refs) {
+		ref := g.refs[name]
+		if !strings.HasPrefix(name, "refs/heads/") || ref.Type() != plumbing.HashReference {
+			continue
+		}
+		for h := range g.ancestors(ref.Hash()) {
+			reach[h]++
+			owner[h] = name
+		}
+	}
+	clusters := make(map[string][]plumbing.Hash)
+	for h, n := range reach {
+		if n == 1 {
+			clusters[owner[h]] = append(clusters[owner[h]], h)
+		}
+	}
+	i := 0
+	for _, name := range sortedRefNames(g.refs) {
+		hs := clusters[name]
+		if len(hs) == 0 {
+			continue
+		}
+		sortHashes(hs)
+		fmt.Fprintf(w, "\tsubgraph \"cluster_%d\" {\n", i)
+		attrs := map[string]string{"label": escapeLabel(name), "style": "dashed"}
+		if !opts.noColor {
+			attrs["color"] = palette["ref"]
+		}
+		fmt.Fprintf(w, "\t\tgraph %s;\n", renderAttrs(attrs))
+		for _, h := range hs {
+			fmt.Fprintf(w, "\t\t%s;\n", dotID(h.String()))
+		}
+		fmt.Fprintln(w, "\t}")
+		i++
+	}
+}
+
+// branchColors assigns a palette color to every branch in the graph, in name
+// order, and tints each commit with the color of the first branch it is
+// reachable from. Both maps are keyed by node name.
+func (g *graph) branchColors() (branches, commits map[string]string) {
+	branches = make(map[string]string)
+	commits = make(map[string]string)
+	for _, name := range sortedRefNames(g.refs) {
+		if !strings.HasPrefix(name, "refs/heads/") {
+			continue
+		}
+		color := branchPalette[len(branches)%len(branchPalette)]
+		branches[name] = color
+		ref := g.refs[name]
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		queue := []plumbing.Hash{ref.Hash()}
+		for len(queue) > 0 {
+			h := queue[0]
+			queue = queue[1:]
+			if !g.is(h, commitType) {
+				continue
+			}
+			if _, ok := commits[h.String()]; ok {
+				continue
+			}
+			commits[h.String()] = color
+			queue = append(queue, g.parents(h)...)
+		}
+	}
+	return branches, commits
+}
+
+// extension returns the file extension of the blob h. A blob stored under
+// names with different extensions is bucketed under the lexically first one
+// so the choice is stable. Blobs without an extension, or whose name is not
+// known, are bucketed under "(none)".
+func (g *graph) extension(h plumbing.Hash) string {
+	ext := ""
+	for _, p := range g.paths[h] {
+		if e := path.Ext(p); e != "" && (ext == "" || e < ext) {
+			ext = e
+		}
+	}
+	if ext == "" {
+		return "(none)"
+	}
+	return ext
+}
+
+// extensionColors assigns a palette color to every blob extension in the
+// graph, in sorted order.
+func extensionColors(g *graph) map[string]string {
+	set := make(map[string]bool)
+	for _, h := range g.hashes(blobType) {
+		set[g.extension(h)] = true
+	}
+	exts := make([]string, 0, len(set))
+	for ext := range set {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	colors := make(map[string]string, len(exts))
+	for i, ext := range exts {
+		colors[ext] = extensionPalette[i%len(extensionPalette)]
+	}
+	return colors
+}
+
+// graphLabel returns the escaped graph-level label built from -title and
+// -caption, or the empty string if neither is set.
+func graphLabel(g *graph, opts *options) string {
+	var lines []string
+	if opts.title != "" {
+		lines = append(lines, escapeLabel(opts.title))
+	}
+	if opts.caption {
+		var counts []string
+		for _, c := range []struct {
+			n    int
+			noun string
+		}{
+			{g.count(tagType), "tag"},
+			{g.count(commitType), "commit"},
+			{g.count(treeType), "tree"},
+			{g.count(blobType), "blob"},
+		} {
+			if c.n == 0 {
+				continue
+			}
+			noun := c.noun
+			if c.n != 1 {
+				noun += "s"
+			}
+			counts = append(counts, fmt.Sprintf("%d %s", c.n, noun))
+		}
+		if len(counts) == 0 {
+			counts = append(counts, "no objects")
+		}
+		lines = append(lines, strings.Join(counts, ", "))
+	}
+	return strings.Join(lines, "\\n")
+}
+
+// renderRanks constrains commits that share a generation number in gens to
+// the same rank, so every commit is laid out on its own row below all of its
+// children. With -time-order, invisible edges between the commits of each
+// rank lay them out from left to right by committer date.
+func renderRanks(w io.Writer, g *graph, gens map[plumbing.Hash]int, opts *options) {
+	byGen := make(map[int][]plumbing.Hash)
+	max := 0
+	for h, n := range gens {
+		byGen[n] = append(byGen[n], h)
+		if n > max {
+			max = n
+		}
+	}
+	for n := max; n > 0; n-- {
+		hs := byGen[n]
+		if len(hs) == 0 {
+			continue
+		}
+		sortHashes(hs)
+		if opts.timeOrder {
+			g.sortCommitsByTime(hs)
+		}
+		fmt.Fprint(w, "\t{rank=same;")
+		for _, h := range hs {
+			fmt.Fprintf(w, " %s;", dotID(h.String()))
+		}
+		if opts.timeOrder {
+			for i := 1; i < len(hs); i++ {
+				fmt.Fprintf(w, " %s -> %s [style=\"invis\"];", dotID(hs[i-1].String()), dotID(hs[i].String()))
+			}
+		}
+		fmt.Fprintln(w, "}")
+	}
+}
+
+// renderSiblings constrains the commits that share a parent to the same rank,
+// joined by invisible edges in hash order, so siblings line up side by side.
+// This only moves nodes in the dot engine's layout; the invisible edges are
+// not part of the graph.
+func renderSiblings(w io.Writer, g *graph) {
+	children := make(map[plumbing.Hash][]plumbing.Hash)
+	for _, h := range g.hashes(commitType) {
+		for _, p := range g.parents(h) {
+			children[p] = append(children[p], h)
+		}
+	}
+	for _, p := range g.hashes(commitType) {
+		hs := children[p]
+		if len(hs) < 2 {
+			continue
+		}
+		fmt.Fprint(w, "\t{rank=same;")
+		for _, h := range hs {
+			fmt.Fprintf(w, " %s;", dotID(h.String()))
+		}
+		for i := 1; i < len(hs); i++ {
+			fmt.Fprintf(w, " %s -> %s [style=\"invis\"];", dotID(hs[i-1].String()), dotID(hs[i].String()))
+		}
+		fmt.Fprintln(w, "}")
+	}
+}
+
+// renderNode writes the declaration of the object node h, of type t, with the
+// given attributes, adding a tooltip, link and comment when they are enabled.
+// Objects that refer to themselves are outlined in red, as their edges to
+// themselves were dropped.
+func (g *graph) renderNode(w io.Writer, h plumbing.Hash, t objectType, attrs map[string]string, opts *options) {
+	if g.selfRefs[h] {
+		if attrs["shape"] != "record" {
+			attrs["label"] += "\\n(refers to itself)"
+		}
+		if c, ok := attrs["color"]; ok {
+			attrs["fillcolor"] = c
+		}
+		attrs["color"] = "red"
+	}
+	if opts.htmlLabels && t == commitType {
+		extra := strings.TrimPrefix(attrs["label"], g.nodeLabel(h, "commit", opts))
+		attrs["label"] = htmlValue(g.htmlCommitLabel(h, extra, opts))
+	}
+	// Objects outside the -only-objects-in-pack packfile are grayed out
+	// like those far from a highlighted object.
+	outside := opts.packIndex != nil && !g.packed[h]
+	emphasize(attrs, g.highlighted[h], outside || g.near != nil && !g.near[h.String()], opts)
+	if opts.typeComments {
+		attrs["comment"] = t.String()
+	}
+	if opts.tooltips {
+		attrs["tooltip"] = h.String()
+	}
+	if u := g.nodeURL(h, t, opts); u != "" {
+		attrs["URL"] = escapeLabel(u)
+	}
+	fmt.Fprintf(w, "\t%s %s;\n", dotID(h.String()), renderAttrs(attrs))
+}
+
+// nodeURL returns the link for the object h of type t, from the -url-commit,
+// -url-tree or -url-blob template for its type or else -url-template. {hash}
+// is replaced by its full hash and {path} by the first path it was found
+// under, escaped for a URL, or by nothing.
+func (g *graph) nodeURL(h plumbing.Hash, t objectType, opts *options) string {
+	tmpl := map[objectType]string{
+		commitType: opts.urlCommit,
+		treeType:   opts.urlTree,
+		blobType:   opts.urlBlob,
+	}[t]
+	if tmpl == "" {
+		tmpl = opts.urlTemplate
+	}
+	if tmpl == "" {
+		return ""
+	}
+	var p string
+	if ps := g.paths[h]; len(ps) > 0 {
+		segs := strings.Split(ps[0], "/")
+		for i, seg := range segs {
+			segs[i] = url.PathEscape(seg)
+		}
+		p = strings.Join(segs, "/")
+	}
+	return strings.NewReplacer("{hash}", h.String(), "{path}", p).Replace(tmpl)
+}
+
+// renderAttrs formats attrs as a DOT attribute list, sorted by key so the
+// output is stable from run to run.
+func renderAttrs(attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var as []string
+	for _, k := range keys {
+		if v := attrs[k]; strings.HasPrefix(v, htmlMarker) {
+			as = append(as, fmt.Sprintf("%s=<%s>", k, strings.TrimPrefix(v, htmlMarker)))
+			continue
+		}
+		as = append(as, fmt.Sprintf("%s=\"%s\"", k, attrs[k]))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(as, ","))
+}
+
+// setAttrs sets the attributes given by -graph-attr, -node-attr or
+// -edge-attr in attrs, escaping their values.
+func setAttrs(attrs map[string]string, set attrList) {
+	for k, v := range set {
+		attrs[k] = escapeLabel(v)
+	}
+}
+
+// labelEscaper escapes the characters that are significant inside a
+// double-quoted DOT string.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes s for use inside a double-quoted DOT string. Every
+// node name and label written to DOT goes through it, as reference names and
+// paths may contain quotes, backslashes and newlines.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// dotID returns the node name s as an escaped, double-quoted DOT ID.
+func dotID(s string) string {
+	return `"` + escapeLabel(s) + `"`
+}
+
+func label(h plumbing.Hash, t string, opts *options) string {
+	if opts.noTypes {
+		return abbrev(h, opts.abbrev)
+	}
+	return t + "\\n" + abbrev(h, opts.abbrev)
+}
+
+func abbrev(h plumbing.Hash, n int) string {
+	return h.String()[:n]
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dotNode returns the line of out declaring the node id, or "".
+func dotNode(out, id string) string {
+	prefix := "\t" + dotID(id) + " ["
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestRootCommits(t *testing.T) {
+	f := newFixture(t)
+	first := f.commit("first root")
+	child := f.commit("child")
+	f.git("checkout", "-q", "--orphan", "other")
+	second := f.commit("second root")
+	merge := f.commitTree("merge", child, second)
+	f.git("update-ref", "refs/heads/main", merge)
+	out := f.render(testOptions())
+
+	tests := []struct {
+		name string
+		h    string
+		root bool
+	}{
+		{"first root", first, true},
+		{"second root", second, true},
+		{"child", child, false},
+		{"merge", merge, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := dotNode(out, tt.h)
+			if line == "" {
+				t.Fatalf("%s is missing:\n%s", tt.h, out)
+			}
+			if got := strings.Contains(line, `peripheries="2"`); got != tt.root {
+				t.Errorf("double border = %v, want %v: %s", got, tt.root, line)
+			}
+		})
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"refs/heads/main", "refs/heads/main"},
+		{`we"ird`, `we\"ird`},
+		{`back\slash`, `back\\slash`},
+		{"new\nline", `new\nline`},
+		{`\"` + "\n", `\\\"\n`},
+	}
+	for _, tt := range tests {
+		if got := escapeLabel(tt.in); got != tt.want {
+			t.Errorf("escapeLabel(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestPathologicalRefNames checks that reference names git would refuse to
+// create, written directly into the repository, still give valid DOT.
+func TestPathologicalRefNames(t *testing.T) {
+	f := newFixture(t)
+	c := f.commit("first")
+	names := []string{`we"ird`, `back\slash`, "new\nline"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(f.dir, ".git", "refs", "heads", name), []byte(c+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, decorate := range []string{"boxes", "labels", "both"} {
+		t.Run(decorate, func(t *testing.T) {
+			opts := testOptions()
+			opts.decorate = decorate
+			out := f.render(opts)
+			for _, name := range names {
+				if strings.Contains(out, name) {
+					t.Errorf("%q written unescaped:\n%s", name, out)
+				}
+				if want := escapeLabel(name); !strings.Contains(out, want) {
+					t.Errorf("%s is missing:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
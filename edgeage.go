@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// The hues, as Graphviz HSV fractions, at the ends of the -color-edges-by-age
+// gradient: blue for the oldest commits and red for the newest.
+const (
+	oldestHue = 0.667
+	newestHue = 0.0
+)
+
+// ageColors maps each commit to the color of the edges to its parents under
+// -color-edges-by-age, placing its committer date along a gradient between
+// the oldest and newest commits in the graph. It logs the dates at the ends
+// of the gradient as a legend.
+func (g *graph) ageColors() map[plumbing.Hash]string {
+	var oldest, newest time.Time
+	for _, h := range g.hashes(commitType) {
+		ci, ok := g.info[h]
+		if !ok {
+			continue
+		}
+		when := ci.committer.When
+		if oldest.IsZero() || when.Before(oldest) {
+			oldest = when
+		}
+		if newest.IsZero() || when.After(newest) {
+			newest = when
+		}
+	}
+	colors := make(map[plumbing.Hash]string)
+	if oldest.IsZero() {
+		return colors
+	}
+	span := newest.Sub(oldest)
+	for _, h := range g.hashes(commitType) {
+		ci, ok := g.info[h]
+		if !ok {
+			continue
+		}
+		f := 1.0
+		if span > 0 {
+			f = float64(ci.committer.When.Sub(oldest)) / float64(span)
+		}
+		colors[h] = hsvColor(oldestHue + f*(newestHue-oldestHue))
+	}
+	logger.Printf("edge colors: %s (blue) oldest to %s (red) newest",
+		oldest.Format("2006-01-02 15:04:05 -0700"), newest.Format("2006-01-02 15:04:05 -0700"))
+	return colors
+}
+
+// hsvColor returns a Graphviz color of the given hue at a fixed saturation
+// and value.
+func hsvColor(hue float64) string {
+	return fmt.Sprintf("%.3f 0.800 0.900", hue)
+}
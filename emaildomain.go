@@ -0,0 +1,64 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// unknownDomainColor is the color of commits whose author email has no
+// domain under -color-by-email-domain.
+const unknownDomainColor = "lightgray"
+
+// emailDomain returns the lower-cased domain of an email address, or "" if
+// it has none.
+func emailDomain(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[i+1:]))
+}
+
+// domainColor returns the palette color of an email domain. It is chosen by
+// a hash of the domain rather than the order domains are seen in, so a
+// domain keeps its color from one graph to the next.
+func domainColor(domain string) string {
+	if domain == "" {
+		return unknownDomainColor
+	}
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	return branchPalette[h.Sum32()%uint32(len(branchPalette))]
+}
+
+// domainColors colors each commit by the domain of its author's email
+// address, and logs a legend of the domains in the graph and their colors.
+func (g *graph) domainColors() map[plumbing.Hash]string {
+	colors := make(map[plumbing.Hash]string)
+	domains := make(map[string]bool)
+	for _, h := range g.hashes(commitType) {
+		ci, ok := g.info[h]
+		if !ok {
+			continue
+		}
+		d := emailDomain(ci.author.Email)
+		domains[d] = true
+		colors[h] = domainColor(d)
+	}
+	var names []string
+	for d := range domains {
+		names = append(names, d)
+	}
+	sort.Strings(names)
+	for _, d := range names {
+		if d == "" {
+			logger.Printf("(unknown): %s", unknownDomainColor)
+			continue
+		}
+		logger.Printf("%s: %s", d, domainColor(d))
+	}
+	return colors
+}
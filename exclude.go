@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// exclude marks every commit reachable from the reference or object named n
+// as excluded, so the walk leaves them out of the graph.
+func (g *graph) exclude(ctx context.Context, r *git.Repository, n string) error {
+	h, err := resolveCommit(r, n)
+	if err != nil {
+		return err
+	}
+	queue := []plumbing.Hash{h}
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		h := queue[0]
+		queue = queue[1:]
+		if g.excluded[h] {
+			continue
+		}
+		commit, err := object.GetCommit(r.Storer, h)
+		if err != nil {
+			return err
+		}
+		infof("exclude commit %s", h)
+		g.excluded[h] = true
+		queue = append(queue, commit.ParentHashes...)
+	}
+	return nil
+}
+
+// dropExcluded removes the edges into excluded commits, which were never
+// added to the graph, along with the tags and references that led only to
+// them.
+func (g *graph) dropExcluded() {
+	gone := make(map[plumbing.Hash]bool, len(g.excluded))
+	for h := range g.excluded {
+		gone[h] = true
+	}
+	g.dropRefsInto(gone)
+	for h, es := range g.edges {
+		var kept []edge
+		for _, e := range es {
+			if !gone[e.target] {
+				kept = append(kept, e)
+			}
+		}
+		g.edges[h] = kept
+	}
+}
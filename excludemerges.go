@@ -0,0 +1,58 @@
+package main
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// dropMerges removes the merge commits skipped by -exclude-merges, pointing
+// the edges and hash references that led to each at its first parent, or at
+// the first commit down its first-parent history that is not a merge. The
+// history merged in by their other parents is not walked through them, so it
+// is only in the graph if something else reaches it. Edges and references
+// that would lead to a commit not in the graph, such as an excluded one, are
+// dropped.
+func (g *graph) dropMerges() {
+	mainline := func(h plumbing.Hash) (plumbing.Hash, bool) {
+		for {
+			p, ok := g.skippedMerges[h]
+			if !ok {
+				_, ok := g.nodes[h]
+				return h, ok
+			}
+			h = p
+		}
+	}
+	for h := range g.skippedMerges {
+		delete(g.nodes, h)
+		delete(g.edges, h)
+	}
+	// Rewiring can make edges identical, so re-add them all.
+	edges := g.edges
+	g.edges = make(map[plumbing.Hash][]edge, len(edges))
+	g.edgeSet = make(map[edgeKey]bool)
+	for h, es := range edges {
+		for _, e := range es {
+			if _, ok := g.skippedMerges[e.target]; ok {
+				t, ok := mainline(e.target)
+				if !ok {
+					continue
+				}
+				e.target = t
+			}
+			g.addEdge(h, e)
+		}
+	}
+	for name, ref := range g.refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		if _, ok := g.skippedMerges[ref.Hash()]; !ok {
+			continue
+		}
+		if t, ok := mainline(ref.Hash()); ok {
+			g.refs[name] = plumbing.NewHashReference(ref.Name(), t)
+		} else {
+			delete(g.refs, name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// excludedPath reports whether the tree entry at path p matches one of the
+// -exclude-path globs, and so is left out of the graph along with everything
+// beneath it. A glob containing a slash is matched against the whole path
+// from the root tree; one without is matched against the entry's name at any
+// depth, like a .gitignore pattern. A trailing slash is ignored.
+func (g *graph) excludedPath(p string) bool {
+	for _, glob := range g.opts.excludePaths {
+		glob = strings.TrimSuffix(glob, "/")
+		target := p
+		if !strings.Contains(glob, "/") {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(strings.TrimPrefix(glob, "/"), target); ok {
+			debugf("skip %s: matches -exclude-path %s", p, glob)
+			return true
+		}
+	}
+	return false
+}
+
+// excludedDir reports whether the path p, or any of the directories leading
+// to it, is excluded by -exclude-path.
+func (g *graph) excludedDir(p string) bool {
+	for dir := p; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if g.excludedPath(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// newTreePrefix records that the tree h is walked under the path prefix. When
+// -exclude-path has a pattern matching full paths, a tree shared by several
+// directories can have entries excluded under one and not another, so it
+// reports whether prefix is a path h has not been walked under before.
+// Otherwise trees are walked once, and it reports false.
+func (g *graph) newTreePrefix(h plumbing.Hash, prefix string) bool {
+	byPath := false
+	for _, glob := range g.opts.excludePaths {
+		if strings.Contains(strings.TrimSuffix(glob, "/"), "/") {
+			byPath = true
+		}
+	}
+	if !byPath {
+		return false
+	}
+	if g.treePrefixes[h] == nil {
+		g.treePrefixes[h] = make(map[string]bool)
+		g.treeKept[h] = make(map[string]bool)
+	}
+	if g.treePrefixes[h][prefix] {
+		return false
+	}
+	g.treePrefixes[h][prefix] = true
+	return true
+}
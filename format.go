@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A renderer writes a graph to w in some output format.
+type renderer func(w io.Writer, g *graph, opts *options) error
+
+// renderers maps each supported -format to its renderer.
+var renderers = map[string]renderer{
+	"adjacency":   renderAdjacency,
+	"cmapx":       renderCmapx,
+	"d2":          renderD2,
+	"dot":         renderDOT,
+	"graphml":     renderGraphML,
+	"gvjson":      graphviz("json"),
+	"json":        renderJSON,
+	"mermaid-git": renderMermaidGit,
+	"plantuml":    renderPlantUML,
+	"png":         graphviz("png"),
+	"svg":         graphviz("svg"),
+	"text-tree":   renderTextTree,
+}
+
+// A stream is a listener that writes the graph as the walk discovers it.
+type stream interface {
+	listener
+	// close flushes the output and returns the first error encountered
+	// writing it.
+	close() error
+}
+
+// streamers maps each format that is written during the walk, rather than
+// rendered from the finished graph, to a function creating its stream. These
+// formats cannot be sorted or pruned.
+var streamers = map[string]func(w io.Writer) stream{
+	"ndjson": newNDJSONStream,
+}
+
+// formatNames returns the names of every supported -format, rendered or
+// streamed, in alphabetical order.
+func formatNames() []string {
+	var names []string
+	for name := range renderers {
+		names = append(names, name)
+	}
+	for name := range streamers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// palette is the fill color of each kind of node.
+var palette = map[string]string{
+	"tag":    "lightskyblue",
+	"commit": "yellowgreen",
+	"tree":   "tomato",
+	"blob":   "gold",
+	"ref":    "plum",
+
+	"missing": "gray",
+	"corrupt": "tomato",
+	"stash":   "lightpink",
+
+	// With -color-refs-by-kind, references are colored by their kind
+	// rather than all as "ref".
+	"ref.head":   "orchid",
+	"ref.branch": "palegreen",
+	"ref.tag":    "lightsteelblue",
+	"ref.remote": "lightsalmon",
+	"ref.note":   "khaki",
+}
+
+// extensionFormats maps -output file extensions to the format they imply
+// when -format is not given.
+var extensionFormats = map[string]string{
+	".d2":      "d2",
+	".dot":     "dot",
+	".gv":      "dot",
+	".graphml": "graphml",
+	".json":    "json",
+	".map":     "cmapx",
+	".ndjson":  "ndjson",
+	".puml":    "plantuml",
+	".png":     "png",
+	".svg":     "svg",
+	".tsv":     "adjacency",
+}
+
+// formatFor returns the format implied by the extension of the output file
+// name, or dot if there is none or the extension is not recognized.
+func formatFor(output string) string {
+	if f, ok := extensionFormats[strings.ToLower(filepath.Ext(output))]; ok {
+		return f
+	}
+	return "dot"
+}
+
+// graphviz returns a renderer that lays out the DOT rendering of the graph
+// with Graphviz, producing the given dot -T output format.
+func graphviz(format string) renderer {
+	return func(w io.Writer, g *graph, opts *options) error {
+		return runDot(w, g, opts, "-T"+format)
+	}
+}
+
+// renderCmapx writes a client-side HTML image map of the graph, linking each
+// node to its -url-template. When writing to an -output file, the PNG image
+// the map belongs to is written beside it, with the extension changed to
+// .png, by the same run of dot: a PNG laid out separately may not match the
+// map's coordinates.
+func renderCmapx(w io.Writer, g *graph, opts *options) error {
+	if opts.output == "" {
+		return runDot(w, g, opts, "-Tcmapx")
+	}
+	png := strings.TrimSuffix(opts.output, filepath.Ext(opts.output)) + ".png"
+	return runDot(w, g, opts, "-Tpng", "-o"+png, "-Tcmapx")
+}
+
+// runDot lays out the DOT rendering of the graph with Graphviz, running dot
+// with the given arguments and writing its standard output to w.
+func runDot(w io.Writer, g *graph, opts *options, args ...string) error {
+	dot, err := exec.LookPath("dot")
+	if err != nil {
+		return fmt.Errorf("-format=%s requires Graphviz: %v", opts.format, err)
+	}
+	var in bytes.Buffer
+	if err := renderDOT(&in, g, opts); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(dot, args...)
+	cmd.Stdin = &in
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("dot %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// fsck checks the repository for -fsck once it has been walked, logging, much
+// as git fsck does, the references that point at missing objects or
+// references, the objects the walk found missing and the dangling commits:
+// those reachable from no reference that are not the parent of another
+// unreachable commit. Dangling commits in the graph are drawn dotted.
+func (g *graph) fsck(ctx context.Context, r *git.Repository) error {
+	s := r.Storer
+	var tips []plumbing.Hash
+	broken := 0
+	refs, err := r.References()
+	if err != nil {
+		return fmt.Errorf("fsck: %v", err)
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.SymbolicReference {
+			// An unborn HEAD is not broken, and is reported by the walk.
+			if _, err := s.Reference(ref.Target()); err == plumbing.ErrReferenceNotFound && ref.Name() != plumbing.HEAD {
+				warnf("fsck: broken reference %s: points at %s, which does not exist", ref.Name(), ref.Target())
+				broken++
+			}
+			return nil
+		}
+		h := ref.Hash()
+		for {
+			obj, err := s.EncodedObject(plumbing.AnyObject, h)
+			if err == plumbing.ErrObjectNotFound {
+				warnf("fsck: broken reference %s: points at missing object %s", ref.Name(), h)
+				broken++
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("fsck %s: %v", ref.Name(), err)
+			}
+			switch obj.Type() {
+			case plumbing.TagObject:
+				tag, err := object.DecodeTag(s, obj)
+				if err != nil {
+					warnf("fsck: tag %s of %s cannot be read: %v", h, ref.Name(), err)
+					return nil
+				}
+				h = tag.Target
+				continue
+			case plumbing.CommitObject:
+				tips = append(tips, h)
+			}
+			return nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// missing holds the objects in the graph or history that are not in
+	// the repository, and the names of the objects referring to each.
+	missing := make(map[plumbing.Hash]map[string]bool)
+	refer := func(h plumbing.Hash, by string) {
+		if missing[h] == nil {
+			missing[h] = make(map[string]bool)
+		}
+		if by != "" {
+			missing[h][by] = true
+		}
+	}
+	reached := make(map[plumbing.Hash]bool)
+	for len(tips) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		h := tips[len(tips)-1]
+		tips = tips[:len(tips)-1]
+		if reached[h] {
+			continue
+		}
+		reached[h] = true
+		commit, err := object.GetCommit(s, h)
+		if err != nil {
+			warnf("fsck: commit %s cannot be read: %v", h, err)
+			continue
+		}
+		for _, p := range commit.ParentHashes {
+			if s.HasEncodedObject(p) != nil {
+				refer(p, h.String())
+				continue
+			}
+			tips = append(tips, p)
+		}
+	}
+
+	unreachable := make(map[plumbing.Hash]bool)
+	merged := make(map[plumbing.Hash]bool)
+	commits, err := s.IterEncodedObjects(plumbing.CommitObject)
+	if err != nil {
+		return fmt.Errorf("fsck: %v", err)
+	}
+	err = commits.ForEach(func(obj plumbing.EncodedObject) error {
+		if reached[obj.Hash()] {
+			return nil
+		}
+		commit, err := object.DecodeCommit(s, obj)
+		if err != nil {
+			warnf("fsck: commit %s cannot be read: %v", obj.Hash(), err)
+			return nil
+		}
+		unreachable[commit.Hash] = true
+		for _, p := range commit.ParentHashes {
+			merged[p] = true
+		}
+		return nil
+	})
+	if err != nil {
+		// The dangling commits found so far are still reported.
+		warnf("fsck: stopped looking for dangling commits: %v", err)
+	}
+	for _, h := range sortedHashes(unreachable) {
+		if !merged[h] {
+			warnf("fsck: dangling commit %s", h)
+			g.dangling[h] = true
+		}
+	}
+
+	for _, h := range g.hashes(missingType) {
+		refer(h, "")
+	}
+	for h, es := range g.edges {
+		for _, e := range es {
+			if g.is(e.target, missingType) {
+				refer(e.target, h.String())
+			}
+		}
+	}
+	hs := make([]plumbing.Hash, 0, len(missing))
+	for h := range missing {
+		hs = append(hs, h)
+	}
+	sortHashes(hs)
+	for _, h := range hs {
+		var by []string
+		for name := range missing[h] {
+			by = append(by, name)
+		}
+		sort.Strings(by)
+		if len(by) > 0 {
+			warnf("fsck: missing object %s, referenced by %s", h, strings.Join(by, ", "))
+		} else {
+			warnf("fsck: missing object %s", h)
+		}
+	}
+	warnf("fsck: %d broken references, %d missing objects, %d dangling commits", broken, len(missing), len(g.dangling))
+	return nil
+}
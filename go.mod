@@ -0,0 +1,24 @@
+module github.com/orirawlings/git-graphviz
+
+go 1.24
+
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	gopkg.in/src-d/go-billy.v4 v4.3.2
+	gopkg.in/src-d/go-git.v4 v4.6.0
+)
+
+require (
+	github.com/emirpasic/gods v1.12.0 // indirect
+	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
+	github.com/kevinburke/ssh_config v0.0.0-20190725054713-01f96b0aa0cd // indirect
+	github.com/mitchellh/go-homedir v1.1.0 // indirect
+	github.com/sergi/go-diff v1.0.0 // indirect
+	github.com/src-d/gcfg v1.4.0 // indirect
+	github.com/xanzy/ssh-agent v0.2.1 // indirect
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
+	golang.org/x/net v0.0.0-20190724013045-ca1201d0de80 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.3.0 // indirect
+	gopkg.in/warnings.v0 v0.1.2 // indirect
+)
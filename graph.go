@@ -0,0 +1,1216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// graph holds the objects and references discovered by a single walk.
+type graph struct {
+	refs  map[string]*plumbing.Reference
+	nodes map[plumbing.Hash]objectType
+	edges map[plumbing.Hash][]edge
+
+	// edgeSet holds every edge added, keyed by its source, so duplicates
+	// can be found with a single lookup.
+	edgeSet map[edgeKey]bool
+
+	// paths records the paths, relative to the root tree of the commit
+	// that first reached them, under which trees, blobs and submodules
+	// were found. A tree shared by several directories is only walked
+	// once, unless -exclude-path matches full paths, so entries below it
+	// only carry paths beneath its first location.
+	paths map[plumbing.Hash][]string
+
+	// entries holds the entries of each tree, in order, when they are
+	// needed to render trees as records.
+	entries map[plumbing.Hash][]object.TreeEntry
+
+	// roots holds the objects the walk was started from: those named on
+	// the command line, pointed at by references or found by iterating
+	// every object.
+	roots map[plumbing.Hash]bool
+
+	// requested holds the roots named explicitly by an argument,
+	// -include-object, -changed or -stash.
+	requested map[plumbing.Hash]bool
+
+	// info holds the metadata of each commit in the graph.
+	info map[plumbing.Hash]commitInfo
+
+	// decorations holds the names of the references pointing at each
+	// object, for labeling it with -decorate.
+	decorations map[plumbing.Hash][]string
+
+	// hiddenParents counts the parents of each commit left out by
+	// -max-parents.
+	hiddenParents map[plumbing.Hash]int
+
+	// excluded holds the commits reachable from -exclude-reachable-from,
+	// which the walk skips.
+	excluded map[plumbing.Hash]bool
+
+	// mergeBases holds the merge bases found with -merge-base.
+	mergeBases map[plumbing.Hash]bool
+
+	// sizes caches the size in bytes of blobs whose size has been needed.
+	sizes map[plumbing.Hash]int64
+
+	// stashes numbers the stash commits walked with -stash, 0 being the
+	// newest.
+	stashes map[plumbing.Hash]int
+
+	// shallow holds the boundary commits of a shallow clone.
+	shallow map[plumbing.Hash]bool
+
+	// selfRefs holds the objects that refer to themselves, whose edges
+	// to themselves are dropped.
+	selfRefs map[plumbing.Hash]bool
+
+	// commitGraph is the commit-graph file read with -use-commit-graph,
+	// or nil.
+	commitGraph *commitGraph
+
+	// graphGenerations holds the generation numbers of the commits found
+	// in the commit-graph file, for -rank-by-generation.
+	graphGenerations map[plumbing.Hash]int
+
+	// treePrefixes holds the paths each tree has been walked under, and
+	// treeKept the names of its entries that were not excluded under at
+	// least one of them, when -exclude-path depends on the full path. A
+	// tree is walked again under each new path so that none of its
+	// entries is dropped for being excluded elsewhere.
+	treePrefixes map[plumbing.Hash]map[string]bool
+	treeKept     map[plumbing.Hash]map[string]bool
+
+	// highlighted holds the objects named by -highlight, and near, while
+	// the graph is rendered, the nodes within -highlight-radius edges of
+	// them, or nil if nothing is dimmed.
+	highlighted map[plumbing.Hash]bool
+	near        map[string]bool
+
+	// skippedMerges maps the merge commits skipped by -exclude-merges to
+	// their first parents.
+	skippedMerges map[plumbing.Hash]plumbing.Hash
+
+	// dangling holds the dangling commits found by -fsck.
+	dangling map[plumbing.Hash]bool
+
+	// packed holds the objects in the graph that are in the packfile of
+	// -only-objects-in-pack.
+	packed map[plumbing.Hash]bool
+
+	// corrupted counts the objects that could not be read, with
+	// -ignore-errors-per-object.
+	corrupted int
+
+	// listener, if set, is told of each node and edge as it is added.
+	listener listener
+
+	opts *options
+}
+
+// commitInfo is the metadata of a commit that is kept for labeling and
+// ordering the graph.
+type commitInfo struct {
+	author    object.Signature
+	committer object.Signature
+	message   string
+
+	// parents is the number of parents the commit has, whether or not
+	// they are in the graph, and firstParent the first of them.
+	parents     int
+	firstParent plumbing.Hash
+
+	// changed is the number of files the commit changes from its first
+	// parent, recorded only with -scale-penwidth; -1 if it is unknown.
+	changed int
+}
+
+// newCommitInfo returns the metadata kept of commit.
+func newCommitInfo(commit *object.Commit) commitInfo {
+	ci := commitInfo{
+		author:    commit.Author,
+		committer: commit.Committer,
+		message:   commit.Message,
+		parents:   len(commit.ParentHashes),
+		changed:   -1,
+	}
+	if len(commit.ParentHashes) > 0 {
+		ci.firstParent = commit.ParentHashes[0]
+	}
+	return ci
+}
+
+// objectType is the type of an object node in the graph.
+type objectType int
+
+const (
+	tagType objectType = iota
+	commitType
+	treeType
+	blobType
+	missingType // referenced but not in the -pack packfile or, with -fsck, the repository
+	corruptType // could not be read, with -ignore-errors-per-object
+)
+
+// objectTypes lists every objectType in rendering order.
+var objectTypes = []objectType{tagType, commitType, treeType, blobType, missingType, corruptType}
+
+func (t objectType) String() string {
+	switch t {
+	case tagType:
+		return "tag"
+	case commitType:
+		return "commit"
+	case treeType:
+		return "tree"
+	case blobType:
+		return "blob"
+	case missingType:
+		return "missing"
+	case corruptType:
+		return "corrupt"
+	}
+	return fmt.Sprintf("objectType(%d)", int(t))
+}
+
+// A listener is notified of the nodes and edges of a graph as the walk
+// discovers them, for output formats that are streamed rather than rendered
+// from the finished graph.
+type listener interface {
+	node(typ, id string)
+	edge(from, to, role, label string)
+}
+
+// edge is a link from an object to one of the objects it references.
+type edge struct {
+	target plumbing.Hash
+	role   edgeRole
+	label  string
+}
+
+// edgeKey identifies an edge along with the object it leads from.
+type edgeKey struct {
+	from plumbing.Hash
+	edge
+}
+
+// edgeRole describes the relationship an edge represents.
+type edgeRole int
+
+const (
+	tagTarget    edgeRole = iota // tag to the object it tags
+	commitParent                 // commit to one of its parents
+	commitTree                   // commit to its root tree
+	treeEntry                    // tree to a subtree, blob or submodule commit
+)
+
+func (r edgeRole) String() string {
+	switch r {
+	case tagTarget:
+		return "target"
+	case commitParent:
+		return "parent"
+	case commitTree:
+		return "tree"
+	case treeEntry:
+		return "entry"
+	}
+	return fmt.Sprintf("edgeRole(%d)", int(r))
+}
+
+func newGraph(opts *options) *graph {
+	return &graph{
+		refs:             make(map[string]*plumbing.Reference),
+		nodes:            make(map[plumbing.Hash]objectType),
+		edges:            make(map[plumbing.Hash][]edge),
+		edgeSet:          make(map[edgeKey]bool),
+		paths:            make(map[plumbing.Hash][]string),
+		entries:          make(map[plumbing.Hash][]object.TreeEntry),
+		roots:            make(map[plumbing.Hash]bool),
+		info:             make(map[plumbing.Hash]commitInfo),
+		sizes:            make(map[plumbing.Hash]int64),
+		stashes:          make(map[plumbing.Hash]int),
+		selfRefs:         make(map[plumbing.Hash]bool),
+		shallow:          make(map[plumbing.Hash]bool),
+		graphGenerations: make(map[plumbing.Hash]int),
+		treePrefixes:     make(map[plumbing.Hash]map[string]bool),
+		treeKept:         make(map[plumbing.Hash]map[string]bool),
+		highlighted:      make(map[plumbing.Hash]bool),
+		skippedMerges:    make(map[plumbing.Hash]plumbing.Hash),
+		dangling:         make(map[plumbing.Hash]bool),
+		packed:           make(map[plumbing.Hash]bool),
+		opts:             opts,
+
+		requested:  make(map[plumbing.Hash]bool),
+		mergeBases: make(map[plumbing.Hash]bool),
+		excluded:   make(map[plumbing.Hash]bool),
+
+		hiddenParents: make(map[plumbing.Hash]int),
+	}
+}
+
+// populate walks the objects named by args, along with every reference in
+// the repository if no args are given or -all is set. Every object in the
+// repository, reachable or not, is walked as well when references are walked
+// with -dangling. Objects passed with -include-object, and the index with
+// -index, are walked in either case.
+func (g *graph) populate(ctx context.Context, r *git.Repository, args []string, opts *options) error {
+	if err := g.loadShallow(r); err != nil {
+		return err
+	}
+	if err := g.resolveHighlights(r); err != nil {
+		return fmt.Errorf("-highlight: %v", err)
+	}
+	if opts.useCommitGraph || opts.rankByGeneration {
+		if err := g.loadCommitGraph(r); err != nil {
+			return err
+		}
+	}
+	for _, n := range opts.excludeFrom {
+		if err := g.exclude(ctx, r, n); err != nil {
+			return fmt.Errorf("-exclude-reachable-from: %v", err)
+		}
+	}
+	if opts.index {
+		if err := g.walkIndex(ctx, r); err != nil {
+			return err
+		}
+	}
+	if opts.changed != "" {
+		if err := g.walkChanged(ctx, r, opts.changed); err != nil {
+			return fmt.Errorf("-changed: %v", err)
+		}
+		return nil
+	}
+	if opts.stash {
+		if err := g.walkStash(ctx, r); err != nil {
+			return fmt.Errorf("-stash: %v", err)
+		}
+	}
+	for _, n := range opts.include {
+		h, err := resolveHash(r.Storer, n)
+		if err != nil {
+			return fmt.Errorf("-include-object: %v", err)
+		}
+		g.roots[h] = true
+		g.requested[h] = true
+		if err := g.walk(ctx, r.Storer, h); err != nil {
+			return err
+		}
+	}
+	for _, n := range args {
+		ref, err := r.Reference(plumbing.ReferenceName(n), false)
+		if err != nil {
+			if !isHex(n) {
+				return err
+			}
+			// Try decoding argument as a full or abbreviated hash
+			h, err := resolveHash(r.Storer, n)
+			if err != nil {
+				return err
+			}
+			g.roots[h] = true
+			g.requested[h] = true
+			if err := g.walk(ctx, r.Storer, h); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := g.walkRef(ctx, r.Storer, ref); err != nil {
+			return err
+		}
+	}
+	if len(args) > 0 && !opts.all {
+		return nil
+	}
+	if opts.dangling {
+		objs, err := r.Storer.IterEncodedObjects(plumbing.AnyObject)
+		if err != nil {
+			return err
+		}
+		if err := objs.ForEach(func(obj plumbing.EncodedObject) error {
+			g.roots[obj.Hash()] = true
+			return g.walkObj(ctx, r.Storer, obj)
+		}); err != nil {
+			return err
+		}
+	}
+	refs, err := r.References()
+	if err != nil {
+		return err
+	}
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		return g.walkRef(ctx, r.Storer, ref)
+	})
+}
+
+// walkRef adds ref to the graph, following symbolic references through to
+// the object they ultimately point at. A chain of symbolic references that
+// loops back on itself is reported as an error.
+func (g *graph) walkRef(ctx context.Context, s storer.Storer, ref *plumbing.Reference) error {
+	var chain []string
+	for {
+		name := string(ref.Name())
+		for _, n := range chain {
+			if n == name {
+				return fmt.Errorf("walkRef %s: symbolic reference cycle: %s -> %s", chain[0], strings.Join(chain, " -> "), name)
+			}
+		}
+		chain = append(chain, name)
+		if _, ok := g.refs[name]; ok {
+			return nil
+		}
+		g.refs[name] = ref
+		infof("ref %s", name)
+		g.notifyNode("ref", name)
+		if ref.Type() == plumbing.HashReference {
+			g.notifyEdge(name, ref.Hash().String(), "ref", "")
+			g.roots[ref.Hash()] = true
+			return g.walk(ctx, s, ref.Hash())
+		}
+		target, err := s.Reference(ref.Target())
+		if err == plumbing.ErrReferenceNotFound {
+			// Typically HEAD in a repository without any commits yet.
+			warnf("%s points at unborn branch %s, which has no commits yet", name, ref.Target())
+			return nil
+		}
+		if err != nil {
+			return nil
+		}
+		g.notifyEdge(name, target.Name().String(), "ref", "")
+		ref = target
+	}
+}
+
+func (g *graph) walk(ctx context.Context, s storer.EncodedObjectStorer, h plumbing.Hash) error {
+	if _, ok := g.nodes[h]; ok {
+		debugf("skip %s: already visited", h)
+		return nil
+	}
+	if g.absent(s, h) {
+		return nil
+	}
+	infof("decode %s", h)
+	obj, err := s.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return g.corrupt(h, fmt.Errorf("walk %s: %v", h, err))
+	}
+	return g.walkObj(ctx, s, obj)
+}
+
+func (g *graph) walkObj(ctx context.Context, s storer.EncodedObjectStorer, obj plumbing.EncodedObject) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	h := obj.Hash()
+	switch obj.Type() {
+	case plumbing.TagObject:
+		return g.walkTag(ctx, s, h)
+	case plumbing.CommitObject:
+		return g.walkCommit(ctx, s, h)
+	case plumbing.TreeObject:
+		return g.walkTree(ctx, s, h, "")
+	case plumbing.BlobObject:
+		g.sizes[h] = obj.Size()
+		if g.opts.maxBlobSize > 0 && obj.Size() > int64(g.opts.maxBlobSize) {
+			infof("skip blob %s: %d bytes is larger than -exclude-blobs-larger-than", h, obj.Size())
+			return nil
+		}
+		g.mark(blobType, h)
+	}
+	return nil
+}
+
+func (g *graph) walkTag(ctx context.Context, s storer.EncodedObjectStorer, h plumbing.Hash) error {
+	if g.mark(tagType, h) {
+		debugf("skip tag %s: already visited", h)
+		return nil
+	}
+	infof("decode tag %s", h)
+	tag, err := object.GetTag(s, h)
+	if err != nil {
+		return g.corrupt(h, fmt.Errorf("walkTag %s: %v", h, err))
+	}
+	if g.opts.tagChase {
+		// Skip over any tags of tags, pointing this tag straight at the
+		// object at the end of the chain.
+		seen := map[plumbing.Hash]bool{h: true}
+		for tag.TargetType == plumbing.TagObject {
+			if seen[tag.Target] {
+				return fmt.Errorf("walkTag %s: tag cycle at %s", h, tag.Target)
+			}
+			seen[tag.Target] = true
+			if tag, err = object.GetTag(s, tag.Target); err != nil {
+				return fmt.Errorf("walkTag %s: %v", h, err)
+			}
+		}
+	}
+	g.addEdge(h, edge{target: tag.Target, role: tagTarget})
+	return g.walk(ctx, s, tag.Target)
+}
+
+func (g *graph) walkCommit(ctx context.Context, s storer.EncodedObjectStorer, h plumbing.Hash) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if g.absent(s, h) {
+		return nil
+	}
+	if g.excluded[h] {
+		debugf("skip commit %s: excluded", h)
+		return nil
+	}
+	if g.mark(commitType, h) {
+		debugf("skip commit %s: already visited", h)
+		return nil
+	}
+	commit, graphed, err := g.graphCommit(h)
+	if err != nil {
+		return fmt.Errorf("walkCommit %s: %v", h, err)
+	}
+	if !graphed {
+		infof("decode commit %s", h)
+		commit, err = object.GetCommit(s, h)
+		if err != nil {
+			return g.corrupt(h, fmt.Errorf("walkCommit %s: %v", h, err))
+		}
+	}
+	if g.opts.excludeMerges && len(commit.ParentHashes) > 1 {
+		infof("skip merge %s: -exclude-merges", h)
+		p := commit.ParentHashes[0]
+		g.skippedMerges[h] = p
+		if g.excluded[p] || g.shallowBoundary(h) {
+			return nil
+		}
+		return g.walkCommit(ctx, s, p)
+	}
+	if err := g.recordGeneration(h); err != nil {
+		return fmt.Errorf("walkCommit %s: %v", h, err)
+	}
+	g.info[h] = newCommitInfo(commit)
+	if g.opts.scalePenwidth {
+		n, ok, err := changedFiles(ctx, s, commit)
+		if err != nil {
+			return fmt.Errorf("walkCommit %s: %v", h, err)
+		}
+		if ok {
+			ci := g.info[h]
+			ci.changed = n
+			g.info[h] = ci
+		}
+	}
+	parents := commit.ParentHashes
+	if g.shallowBoundary(h) {
+		infof("skip parents of commit %s: shallow", h)
+		parents = nil
+	}
+	if n := g.opts.maxParents; n > 0 && len(parents) > n {
+		infof("skip %d parents of commit %s: more than -max-parents", len(parents)-n, h)
+		g.hiddenParents[h] = len(parents) - n
+		parents = parents[:n]
+	}
+	_, stash := g.stashes[h]
+	for i, p := range parents {
+		if !g.excluded[p] {
+			e := edge{target: p, role: commitParent}
+			if stash && i < len(stashParents) {
+				e.label = stashParents[i]
+			}
+			g.addEdge(h, e)
+		}
+	}
+	if graphed {
+		debugf("skip tree of commit %s: read from the commit-graph", h)
+	} else if g.opts.compactMerges && len(commit.ParentHashes) > 1 {
+		infof("skip tree of commit %s: merge with -compact-merges", h)
+	} else if g.opts.flattenTrees {
+		if err := g.walkFlatTree(ctx, s, h, commit.TreeHash, ""); err != nil {
+			return err
+		}
+	} else {
+		g.addEdge(h, edge{target: commit.TreeHash, role: commitTree})
+		if err := g.walkTree(ctx, s, commit.TreeHash, ""); err != nil {
+			return err
+		}
+	}
+	for _, p := range parents {
+		if err := g.walkCommit(ctx, s, p); err != nil {
+			if g.shallow[h] {
+				return fmt.Errorf("%v (%s is the boundary of a shallow clone; try -allow-shallow)", err, h)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *graph) walkTree(ctx context.Context, s storer.EncodedObjectStorer, h plumbing.Hash, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if g.absent(s, h) {
+		return nil
+	}
+	revisit := g.mark(treeType, h)
+	if revisit && !g.newTreePrefix(h, prefix) {
+		debugf("skip tree %s: already visited", h)
+		return nil
+	}
+	if !revisit {
+		g.newTreePrefix(h, prefix)
+	}
+	infof("decode tree %s", h)
+	t, err := object.GetTree(s, h)
+	if err != nil {
+		return g.corrupt(h, fmt.Errorf("walkTree %s: %v", h, err))
+	}
+	if revisit {
+		debugf("walk tree %s again: under %s", h, prefix)
+	}
+	excluded := func(entry object.TreeEntry) bool {
+		if kept := g.treeKept[h]; kept != nil && kept[entry.Name] {
+			return false
+		}
+		return g.excludedPath(path.Join(prefix, entry.Name))
+	}
+	if kept := g.treeKept[h]; kept != nil {
+		for _, entry := range t.Entries {
+			if !excluded(entry) {
+				kept[entry.Name] = true
+			}
+		}
+	}
+	if g.opts.treeAsRecord {
+		g.entries[h] = t.Entries
+		if len(g.opts.excludePaths) > 0 {
+			var kept []object.TreeEntry
+			for _, entry := range t.Entries {
+				if !excluded(entry) {
+					kept = append(kept, entry)
+				}
+			}
+			g.entries[h] = kept
+		}
+	}
+	// A tree may hold the same object under several names. Draw a single
+	// edge to it, labeled with each of those names so none go unseen.
+	// With -show-entry-order, every edge is labeled, and each name is
+	// numbered by the position of its entry, which go-git keeps in git's
+	// canonical order.
+	names := make(map[plumbing.Hash][]string)
+	for i, entry := range t.Entries {
+		if excluded(entry) {
+			continue
+		}
+		n := entry.Name
+		if g.opts.showEntryOrder {
+			n = fmt.Sprintf("%d %s", i+1, entry.Name)
+		}
+		names[entry.Hash] = append(names[entry.Hash], n)
+	}
+	// Entries kept here may have been excluded under the paths the tree
+	// was walked at before, so on a revisit only their edges are added,
+	// and the labels of those already drawn brought up to date.
+	add := func(e edge) {
+		if !revisit || !g.relabelEdge(h, e) {
+			g.addEdge(h, e)
+		}
+	}
+	for _, entry := range t.Entries {
+		p := path.Join(prefix, entry.Name)
+		if excluded(entry) {
+			continue
+		}
+		e := edge{target: entry.Hash, role: treeEntry}
+		if ns := names[entry.Hash]; len(ns) > 1 || g.opts.showEntryOrder {
+			e.label = strings.Join(ns, "\n")
+		}
+		if revisit && g.excludedPath(p) {
+			// Kept under another path, where it was walked.
+			add(e)
+			continue
+		}
+		g.paths[entry.Hash] = append(g.paths[entry.Hash], p)
+		if entry.Mode == filemode.Dir {
+			add(e)
+			if err := g.walkTree(ctx, s, entry.Hash, p); err != nil {
+				return err
+			}
+		}
+		if entry.Mode.IsFile() {
+			skip, err := g.skipBlob(s, entry.Hash)
+			if err != nil {
+				return err
+			}
+			if !skip {
+				if !g.absent(s, entry.Hash) {
+					g.mark(blobType, entry.Hash)
+					if g.opts.collapseBlobs || g.opts.scalePenwidth {
+						if _, err := g.blobSize(s, entry.Hash); err != nil {
+							return err
+						}
+					}
+				}
+				add(e)
+			}
+		}
+		if entry.Mode == filemode.Submodule {
+			add(e)
+			if err := g.walkCommit(ctx, s, entry.Hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// objectSet is the objects of one type in a graph, sorted by hash.
+type objectSet struct {
+	typ    objectType
+	hashes []plumbing.Hash
+}
+
+// objectSets returns the objects of the graph grouped by type, in rendering
+// order.
+func (g *graph) objectSets() []objectSet {
+	byType := make(map[objectType][]plumbing.Hash)
+	for h, t := range g.nodes {
+		byType[t] = append(byType[t], h)
+	}
+	var sets []objectSet
+	for _, t := range objectTypes {
+		sortHashes(byType[t])
+		sets = append(sets, objectSet{t, byType[t]})
+	}
+	return sets
+}
+
+// is reports whether h is an object of type t in the graph.
+func (g *graph) is(h plumbing.Hash, t objectType) bool {
+	typ, ok := g.nodes[h]
+	return ok && typ == t
+}
+
+// hashes returns the objects of type t in the graph, sorted by hash.
+func (g *graph) hashes(t objectType) []plumbing.Hash {
+	var hs []plumbing.Hash
+	for h, typ := range g.nodes {
+		if typ == t {
+			hs = append(hs, h)
+		}
+	}
+	sortHashes(hs)
+	return hs
+}
+
+// count returns the number of objects of type t in the graph.
+func (g *graph) count(t objectType) int {
+	n := 0
+	for _, typ := range g.nodes {
+		if typ == t {
+			n++
+		}
+	}
+	return n
+}
+
+// refTarget returns the node the named reference points at: the object of a
+// hash reference, or the target of a symbolic reference when that target is
+// itself in the graph.
+func (g *graph) refTarget(name string) (string, bool) {
+	ref := g.refs[name]
+	if ref.Type() != plumbing.SymbolicReference {
+		return ref.Hash().String(), true
+	}
+	target := ref.Target().String()
+	_, ok := g.refs[target]
+	return target, ok
+}
+
+// filter removes the parts of the graph that opts leaves out of the output,
+// so that every renderer presents the same graph.
+func (g *graph) filter(opts *options) {
+	if len(g.skippedMerges) > 0 {
+		g.dropMerges()
+	}
+	if !opts.noPrune {
+		g.pruneOrphans()
+	}
+	if len(opts.only) > 0 || len(opts.excludeType) > 0 {
+		g.filterTypes(opts.only, opts.excludeType)
+	}
+	if opts.noIsolated {
+		g.pruneIsolated()
+	}
+	if opts.decorate != "boxes" {
+		g.decorations = g.refDecorations()
+	}
+	if len(g.excluded) > 0 {
+		g.dropExcluded()
+	}
+	if opts.pruneToRefs {
+		g.pruneUnreachable()
+	}
+	if opts.noRefs || opts.decorate == "labels" {
+		g.refs = make(map[string]*plumbing.Reference)
+	}
+	if opts.noBlobEdges {
+		for h, es := range g.edges {
+			var kept []edge
+			for _, e := range es {
+				if !g.is(e.target, blobType) {
+					kept = append(kept, e)
+				}
+			}
+			g.edges[h] = kept
+		}
+	}
+}
+
+// filterTypes removes the objects whose type is not in only, if it is not
+// empty, or is in exclude, along with the edges to and from them and the
+// references pointing at them.
+func (g *graph) filterTypes(only, exclude typeSet) {
+	removed := make(map[plumbing.Hash]bool)
+	for h, t := range g.nodes {
+		if (len(only) == 0 || only[t]) && !exclude[t] {
+			continue
+		}
+		removed[h] = true
+		delete(g.nodes, h)
+	}
+	for h, es := range g.edges {
+		if removed[h] {
+			delete(g.edges, h)
+			continue
+		}
+		var kept []edge
+		for _, e := range es {
+			if !removed[e.target] {
+				kept = append(kept, e)
+			}
+		}
+		g.edges[h] = kept
+	}
+	for name, ref := range g.refs {
+		if ref.Type() == plumbing.HashReference && removed[ref.Hash()] {
+			delete(g.refs, name)
+		}
+	}
+}
+
+// pruneOrphans removes the trees and blobs that are neither walk roots nor
+// the target of any edge, repeating until no more can be removed so that
+// objects only reachable through pruned trees go too.
+func (g *graph) pruneOrphans() {
+	for {
+		incoming := make(map[plumbing.Hash]bool)
+		for _, es := range g.edges {
+			for _, e := range es {
+				incoming[e.target] = true
+			}
+		}
+		pruned := false
+		for h, t := range g.nodes {
+			if (t == treeType || t == blobType) && !incoming[h] && !g.roots[h] {
+				infof("prune %s: no incoming edges", h)
+				delete(g.nodes, h)
+				delete(g.edges, h)
+				pruned = true
+			}
+		}
+		if !pruned {
+			return
+		}
+	}
+}
+
+// pruneUnreachable removes every object that can no longer be reached,
+// through the edges left by the other filters, from a reference or a
+// requested root, along with the edges from it. This catches what the pruning
+// done by individual filters misses, such as trees left hanging off a removed
+// commit's subgraph. References hidden by -no-refs still count, as their
+// objects were asked for, but the roots found by -dangling do not.
+func (g *graph) pruneUnreachable() {
+	reached := make(map[plumbing.Hash]bool)
+	var queue []plumbing.Hash
+	for _, ref := range g.refs {
+		if ref.Type() == plumbing.HashReference {
+			queue = append(queue, ref.Hash())
+		}
+	}
+	for h := range g.requested {
+		queue = append(queue, h)
+	}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if reached[h] {
+			continue
+		}
+		reached[h] = true
+		for _, e := range g.edges[h] {
+			queue = append(queue, e.target)
+		}
+	}
+	for h := range g.nodes {
+		if !reached[h] {
+			infof("prune %s: unreachable from any reference or requested root", h)
+			delete(g.nodes, h)
+			delete(g.edges, h)
+		}
+	}
+}
+
+// dropRefsInto removes what led only to the commits in gone, which have
+// been taken out of the graph: the tags that peel to one of them, the hash
+// references to those commits and tags, and then the symbolic references
+// left pointing at a removed reference. The tags are added to gone, so the
+// edges into them can be cut along with those into the commits; the edges of
+// the tags must still be in place when it is called.
+func (g *graph) dropRefsInto(gone map[plumbing.Hash]bool) {
+	for _, h := range g.hashes(tagType) {
+		if gone[g.peel(h)] {
+			infof("prune %s: tags a pruned commit", h)
+			gone[h] = true
+			delete(g.nodes, h)
+			delete(g.edges, h)
+		}
+	}
+	removed := make(map[plumbing.ReferenceName]bool)
+	for name, ref := range g.refs {
+		if ref.Type() == plumbing.HashReference && gone[ref.Hash()] {
+			infof("prune %s: points at a pruned object", name)
+			removed[ref.Name()] = true
+			delete(g.refs, name)
+		}
+	}
+	for len(removed) > 0 {
+		next := make(map[plumbing.ReferenceName]bool)
+		for name, ref := range g.refs {
+			if ref.Type() == plumbing.SymbolicReference && removed[ref.Target()] {
+				infof("prune %s: points at pruned reference %s", name, ref.Target())
+				next[ref.Name()] = true
+				delete(g.refs, name)
+			}
+		}
+		removed = next
+	}
+}
+
+// corruptedError is returned, with -ignore-errors-per-object, once the graph
+// has been written in spite of the objects that could not be read.
+type corruptedError int
+
+func (n corruptedError) Error() string {
+	return fmt.Sprintf("%d objects could not be read", int(n))
+}
+
+// corrupt handles the error err reading the object h. With
+// -ignore-errors-per-object, the error is logged and h is kept in the graph
+// as a corrupt object, in place of whatever type it was taken for, so the walk
+// can go on. Otherwise err is returned, ending the walk.
+func (g *graph) corrupt(h plumbing.Hash, err error) error {
+	if !g.opts.ignoreObjectErrors {
+		return err
+	}
+	logger.Printf("%v", err)
+	g.nodes[h] = corruptType
+	g.corrupted++
+	return nil
+}
+
+// blobSize returns the size in bytes of the blob h.
+func (g *graph) blobSize(s storer.EncodedObjectStorer, h plumbing.Hash) (int64, error) {
+	if n, ok := g.sizes[h]; ok {
+		return n, nil
+	}
+	obj, err := s.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return 0, fmt.Errorf("blobSize %s: %v", h, err)
+	}
+	g.sizes[h] = obj.Size()
+	return obj.Size(), nil
+}
+
+// skipBlob reports whether the blob h is left out of the graph because it is
+// larger than -exclude-blobs-larger-than.
+func (g *graph) skipBlob(s storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
+	if g.opts.maxBlobSize <= 0 || g.absent(s, h) {
+		return false, nil
+	}
+	n, err := g.blobSize(s, h)
+	if err != nil {
+		return false, err
+	}
+	if n > int64(g.opts.maxBlobSize) {
+		infof("skip blob %s: %d bytes is larger than -exclude-blobs-larger-than", h, n)
+		return true, nil
+	}
+	return false, nil
+}
+
+// pruneIsolated removes the objects that have no edges at all, neither to
+// nor from any other node, unless they were explicitly requested.
+func (g *graph) pruneIsolated() {
+	linked := make(map[plumbing.Hash]bool)
+	for h, es := range g.edges {
+		if len(es) > 0 {
+			linked[h] = true
+		}
+		for _, e := range es {
+			linked[e.target] = true
+		}
+	}
+	for _, ref := range g.refs {
+		if ref.Type() == plumbing.HashReference {
+			linked[ref.Hash()] = true
+		}
+	}
+	for h := range g.nodes {
+		if !linked[h] && !g.requested[h] {
+			infof("prune %s: isolated", h)
+			delete(g.nodes, h)
+		}
+	}
+}
+
+// addEdge records the edge e from h, ignoring it if h already has an
+// identical edge.
+func (g *graph) addEdge(h plumbing.Hash, e edge) {
+	if h == e.target {
+		// Only a corrupt object can refer to itself, and the loop would
+		// say nothing about the shape of the history.
+		if !g.selfRefs[h] {
+			warnf("%s refers to itself (%s); the repository may be corrupt", h, e.role)
+		}
+		g.selfRefs[h] = true
+		return
+	}
+	k := edgeKey{h, e}
+	if g.edgeSet[k] {
+		debugf("skip edge %s -> %s (%s): duplicate", h, e.target, e.role)
+		return
+	}
+	g.edgeSet[k] = true
+	debugf("edge %s -> %s (%s)", h, e.target, e.role)
+	g.edges[h] = append(g.edges[h], e)
+	g.notifyEdge(h.String(), e.target.String(), e.role.String(), e.label)
+}
+
+// relabelEdge gives the edge from h to e.target in e's role the label of e,
+// and reports whether h had such an edge. Streams are not told, as the edge
+// they were sent cannot be taken back.
+func (g *graph) relabelEdge(h plumbing.Hash, e edge) bool {
+	for i, old := range g.edges[h] {
+		if old.target != e.target || old.role != e.role {
+			continue
+		}
+		if old.label != e.label {
+			debugf("relabel edge %s -> %s (%s)", h, e.target, e.role)
+			delete(g.edgeSet, edgeKey{h, old})
+			g.edgeSet[edgeKey{h, e}] = true
+			g.edges[h][i] = e
+		}
+		return true
+	}
+	return false
+}
+
+// mark adds h to the graph as an object of type t and reports whether it was
+// already there.
+func (g *graph) mark(t objectType, h plumbing.Hash) bool {
+	if _, ok := g.nodes[h]; ok {
+		return true
+	}
+	g.nodes[h] = t
+	g.notifyNode(t.String(), h.String())
+	return false
+}
+
+// notifyNode tells the listener, if any, of a new node. Nodes and edges that
+// filter would remove are held back where that can be decided up front.
+func (g *graph) notifyNode(typ, id string) {
+	if g.listener == nil || (typ == "ref" && g.opts.noRefs) {
+		return
+	}
+	g.listener.node(typ, id)
+}
+
+func (g *graph) notifyEdge(from, to, role, label string) {
+	if g.listener == nil {
+		return
+	}
+	if role == "ref" {
+		if g.opts.noRefs {
+			return
+		}
+	} else if g.opts.noBlobEdges && g.is(plumbing.NewHash(to), blobType) {
+		return
+	}
+	g.listener.edge(from, to, role, label)
+}
+
+// walkFlatTree links the commit c directly to every blob and submodule
+// reachable from the tree h, labeling each edge with the entry's full path
+// below prefix. The trees themselves are not added to the graph.
+func (g *graph) walkFlatTree(ctx context.Context, s storer.EncodedObjectStorer, c, h plumbing.Hash, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if g.absent(s, h) {
+		// Without the tree there are no blobs to link to, so link the
+		// commit to the missing tree instead.
+		g.addEdge(c, edge{target: h, role: treeEntry, label: prefix})
+		return nil
+	}
+	infof("decode tree %s", h)
+	t, err := object.GetTree(s, h)
+	if err != nil {
+		if g.opts.ignoreObjectErrors {
+			g.addEdge(c, edge{target: h, role: treeEntry, label: prefix})
+		}
+		return g.corrupt(h, fmt.Errorf("walkFlatTree %s: %v", h, err))
+	}
+	for _, entry := range t.Entries {
+		p := path.Join(prefix, entry.Name)
+		if g.excludedPath(p) {
+			continue
+		}
+		g.paths[entry.Hash] = append(g.paths[entry.Hash], p)
+		if entry.Mode == filemode.Dir {
+			if err := g.walkFlatTree(ctx, s, c, entry.Hash, p); err != nil {
+				return err
+			}
+		}
+		if entry.Mode.IsFile() {
+			skip, err := g.skipBlob(s, entry.Hash)
+			if err != nil {
+				return err
+			}
+			if !skip {
+				if !g.absent(s, entry.Hash) {
+					g.mark(blobType, entry.Hash)
+				}
+				g.addEdge(c, edge{target: entry.Hash, role: treeEntry, label: p})
+			}
+		}
+		if entry.Mode == filemode.Submodule {
+			g.addEdge(c, edge{target: entry.Hash, role: treeEntry, label: p})
+			if err := g.walkCommit(ctx, s, entry.Hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parents returns the parents of the commit h that are part of the graph.
+func (g *graph) parents(h plumbing.Hash) []plumbing.Hash {
+	var ps []plumbing.Hash
+	for _, e := range g.edges[h] {
+		if e.role == commitParent && g.is(e.target, commitType) {
+			ps = append(ps, e.target)
+		}
+	}
+	return ps
+}
+
+// generations numbers each commit in the graph as git does: commits without
+// parents in the graph are generation 1, and every other commit is one more
+// than the highest generation among its parents.
+func (g *graph) generations() map[plumbing.Hash]int {
+	gens := make(map[plumbing.Hash]int)
+	var visit func(h plumbing.Hash) int
+	visit = func(h plumbing.Hash) int {
+		if n, ok := gens[h]; ok {
+			return n
+		}
+		n := 1
+		for _, p := range g.parents(h) {
+			if m := visit(p) + 1; m > n {
+				n = m
+			}
+		}
+		gens[h] = n
+		return n
+	}
+	for _, h := range g.hashes(commitType) {
+		visit(h)
+	}
+	return gens
+}
+
+func sortedHashes(set map[plumbing.Hash]bool) []plumbing.Hash {
+	hs := make([]plumbing.Hash, 0, len(set))
+	for h := range set {
+		hs = append(hs, h)
+	}
+	sortHashes(hs)
+	return hs
+}
+
+func sortedEdgeSources(edges map[plumbing.Hash][]edge) []plumbing.Hash {
+	hs := make([]plumbing.Hash, 0, len(edges))
+	for h := range edges {
+		hs = append(hs, h)
+	}
+	sortHashes(hs)
+	return hs
+}
+
+// commitOrders are the orders of -sort-commits-by.
+var commitOrders = map[string]bool{"hash": true, "date": true, "topo": true}
+
+// sortCommits sorts the commits hs, which are in hash order, into the given
+// order of commitOrders. Ties are left in hash order.
+func (g *graph) sortCommits(hs []plumbing.Hash, order string) {
+	switch order {
+	case "date":
+		g.sortCommitsByTime(hs)
+	case "topo":
+		gens := g.generations()
+		sort.SliceStable(hs, func(i, j int) bool {
+			return gens[hs[i]] < gens[hs[j]]
+		})
+	}
+}
+
+// sortCommitsByTime sorts the commits hs by committer date, oldest first,
+// breaking ties by hash.
+func (g *graph) sortCommitsByTime(hs []plumbing.Hash) {
+	sort.Slice(hs, func(i, j int) bool {
+		ti, tj := g.info[hs[i]].committer.When, g.info[hs[j]].committer.When
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return bytes.Compare(hs[i][:], hs[j][:]) < 0
+	})
+}
+
+func sortHashes(hs []plumbing.Hash) {
+	sort.Slice(hs, func(i, j int) bool {
+		return bytes.Compare(hs[i][:], hs[j][:]) < 0
+	})
+}
+
+func sortedRefNames(refs map[string]*plumbing.Reference) []string {
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
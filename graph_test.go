@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestPruneToRefs(t *testing.T) {
+	f := newFixture(t)
+	f.write("file", "kept\n")
+	kept := f.commit("kept")
+	f.git("checkout", "-q", "--detach")
+	f.write("file", "dangling\n")
+	dangling := f.commit("dangling")
+	blob := f.git("rev-parse", "HEAD:file")
+	f.git("checkout", "-q", "main")
+
+	tests := []struct {
+		name        string
+		pruneToRefs bool
+		args        []string
+		want        bool
+	}{
+		{"dangling", false, nil, true},
+		{"pruned", true, nil, false},
+		{"requested", true, []string{dangling}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.dangling = true
+			opts.all = true
+			opts.pruneToRefs = tt.pruneToRefs
+			out := f.render(opts, tt.args...)
+			if !strings.Contains(out, kept) {
+				t.Errorf("commit %s, reachable from main, is missing:\n%s", kept, out)
+			}
+			for _, h := range []string{dangling, blob} {
+				if got := strings.Contains(out, h); got != tt.want {
+					t.Errorf("object %s in graph = %v, want %v:\n%s", h, got, tt.want, out)
+				}
+			}
+		})
+	}
+}
+
+// TestMergeSharedTree checks that a tree shared by a merge and its parents is
+// drawn once, with an edge from each commit and its own edges drawn once.
+func TestMergeSharedTree(t *testing.T) {
+	f := newFixture(t)
+	f.write("file", "shared\n")
+	base := f.commit("base")
+	ours := f.commit("ours")
+	f.git("checkout", "-q", "-b", "side", base)
+	theirs := f.commit("theirs")
+	merge := f.commitTree("merge", ours, theirs)
+	f.git("update-ref", "refs/heads/main", merge)
+	tree := f.git("rev-parse", merge+"^{tree}")
+	blob := f.git("rev-parse", merge+":file")
+
+	out := f.render(testOptions(), "refs/heads/main")
+	id := dotID(tree)
+	if n := strings.Count(out, "\t"+id+" ["); n != 1 {
+		t.Errorf("tree %s declared %d times, want 1:\n%s", tree, n, out)
+	}
+	for _, c := range []string{base, ours, theirs, merge} {
+		e := dotID(c) + " -> " + id
+		if n := strings.Count(out, e); n != 1 {
+			t.Errorf("edge %s drawn %d times, want 1:\n%s", e, n, out)
+		}
+	}
+	if e := id + " -> " + dotID(blob); strings.Count(out, e) != 1 {
+		t.Errorf("edge %s not drawn exactly once:\n%s", e, out)
+	}
+}
+
+// TestSelfReference checks that an edge from an object to itself is dropped
+// with a warning, and the object outlined instead.
+func TestSelfReference(t *testing.T) {
+	f := newFixture(t)
+	c := plumbing.NewHash(f.commit("first"))
+	r, err := git.PlainOpen(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions()
+	g := newGraph(opts)
+	if err := g.populate(context.Background(), r, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings bytes.Buffer
+	defer func(l *log.Logger) { logger = l }(logger)
+	logger = log.New(&warnings, "", 0)
+	g.addEdge(c, edge{target: c, role: commitParent})
+	for _, e := range g.edges[c] {
+		if e.target == c {
+			t.Errorf("edge from %s to itself was added", c)
+		}
+	}
+	if want := c.String() + " refers to itself"; !strings.Contains(warnings.String(), want) {
+		t.Errorf("warning %q not logged, got %q", want, warnings.String())
+	}
+
+	var out bytes.Buffer
+	if err := renderDOT(&out, g, opts); err != nil {
+		t.Fatal(err)
+	}
+	id := dotID(c.String())
+	if strings.Contains(out.String(), id+" -> "+id) {
+		t.Errorf("self-loop drawn:\n%s", out.String())
+	}
+	outlined := false
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "\t"+id+" [") {
+			outlined = strings.Contains(line, `color="red"`)
+		}
+	}
+	if !outlined {
+		t.Errorf("%s not outlined in red:\n%s", c, out.String())
+	}
+}
+
+// TestSymbolicRefCycle checks that two symbolic references pointing at each
+// other end the walk with an error rather than looping.
+func TestSymbolicRefCycle(t *testing.T) {
+	f := newFixture(t)
+	f.commit("first")
+	f.git("symbolic-ref", "refs/heads/a", "refs/heads/b")
+	f.git("symbolic-ref", "refs/heads/b", "refs/heads/a")
+
+	r, err := git.PlainOpen(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- generateTo(ioutil.Discard, r, nil, testOptions())
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "symbolic reference cycle") {
+			t.Errorf("got error %v, want a symbolic reference cycle", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("walk did not end")
+	}
+}
+
+// dotEdges returns the lines of out drawing edges from the node from to the
+// node to.
+func dotEdges(out, from, to string) []string {
+	var lines []string
+	prefix := "\t" + dotID(from) + " -> " + dotID(to)
+	for _, line := range strings.Split(out, "\n") {
+		if line == prefix+";" || strings.HasPrefix(line, prefix+" [") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestTreeEntriesSharingAnObject(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		target string // the path of the object the edge leads to
+		label  string // the label of the edge, if it has one
+	}{
+		{
+			name:   "distinct blobs",
+			files:  map[string]string{"a": "a\n", "b": "b\n"},
+			target: "a",
+		},
+		{
+			name:   "blob under two names",
+			files:  map[string]string{"a": "same\n", "b": "same\n"},
+			target: "a",
+			label:  `a\nb`,
+		},
+		{
+			name:   "blob under three names",
+			files:  map[string]string{"a": "same\n", "b": "same\n", "c": "same\n"},
+			target: "a",
+			label:  `a\nb\nc`,
+		},
+		{
+			name:   "subtree under two names",
+			files:  map[string]string{"x/f": "same\n", "y/f": "same\n"},
+			target: "x",
+			label:  `x\ny`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			for name, content := range tt.files {
+				f.write(name, content)
+			}
+			c := f.commit("first")
+			tree := f.git("rev-parse", c+"^{tree}")
+			target := f.git("rev-parse", c+":"+tt.target)
+
+			out := f.render(testOptions())
+			edges := dotEdges(out, tree, target)
+			if len(edges) != 1 {
+				t.Fatalf("%d edges from the tree to %s, want 1:\n%s", len(edges), tt.target, out)
+			}
+			label := ""
+			if i := strings.Index(edges[0], `[label="`); i >= 0 {
+				label = strings.TrimSuffix(edges[0][i+len(`[label="`):], `"];`)
+			}
+			if label != tt.label {
+				t.Errorf("edge label = %q, want %q", label, tt.label)
+			}
+		})
+	}
+}
+
+func TestShallowClone(t *testing.T) {
+	src := newFixture(t)
+	first := src.commit("first")
+	second := src.commit("second")
+	third := src.commit("third")
+	f := &fixture{t: t, dir: filepath.Join(t.TempDir(), "shallow")}
+	src.git("clone", "-q", "--depth", "2", "file://"+src.dir, f.dir)
+
+	tests := []struct {
+		name         string
+		allowShallow bool
+		wantErr      string
+	}{
+		{"refused", false, "try -allow-shallow"},
+		{"allowed", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.allowShallow = tt.allowShallow
+			out, err := f.tryRender(opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line := dotNode(out, second); !strings.Contains(line, `(shallow)`) || !strings.Contains(line, "dashed") {
+				t.Errorf("boundary commit %s is not drawn as shallow: %s", second, line)
+			}
+			if line := dotNode(out, third); line == "" || strings.Contains(line, "(shallow)") {
+				t.Errorf("commit %s is missing or drawn as shallow: %s", third, line)
+			}
+			if strings.Contains(out, first) {
+				t.Errorf("commit %s beyond the boundary is drawn:\n%s", first, out)
+			}
+		})
+	}
+}
+
+func TestSharedSubtree(t *testing.T) {
+	f := newFixture(t)
+	f.write("a/lib/x.go", "package lib\n")
+	f.write("a/lib/y.go", "package lib\n\nvar Y int\n")
+	f.write("b/lib/x.go", "package lib\n")
+	f.write("b/lib/y.go", "package lib\n\nvar Y int\n")
+	c := f.commit("first")
+	rev := func(p string) string { return f.git("rev-parse", c+":"+p) }
+	lib, x, y := rev("a/lib"), rev("a/lib/x.go"), rev("a/lib/y.go")
+	if rev("b/lib") != lib {
+		t.Fatal("a/lib and b/lib are different trees")
+	}
+
+	tests := []struct {
+		name    string
+		exclude []string
+		wantX   bool
+	}{
+		{"nothing excluded", nil, true},
+		{"excluded under the first path", []string{"a/lib/x.go"}, true},
+		{"excluded under the second path", []string{"b/lib/x.go"}, true},
+		{"excluded under both paths", []string{"a/lib/x.go", "b/lib/x.go"}, false},
+		{"excluded by name", []string{"x.go"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.excludePaths = tt.exclude
+			out := f.render(opts)
+			for _, p := range []string{"a", "b"} {
+				if len(dotEdges(out, rev(p), lib)) != 1 {
+					t.Errorf("edge from %s to the shared tree not drawn once:\n%s", p, out)
+				}
+			}
+			if len(dotEdges(out, lib, y)) != 1 {
+				t.Errorf("edge from the shared tree to y.go not drawn once:\n%s", out)
+			}
+			if got := len(dotEdges(out, lib, x)) == 1; got != tt.wantX {
+				t.Errorf("edge from the shared tree to x.go drawn = %v, want %v:\n%s", got, tt.wantX, out)
+			}
+
+			// A stream is sent each edge once, however often the
+			// shared tree is walked.
+			want := strings.Count(out, " -> ")
+			opts.format = "ndjson"
+			events := f.render(opts)
+			seen := make(map[ndjsonEvent]bool)
+			n := 0
+			for _, line := range strings.Split(strings.TrimSpace(events), "\n") {
+				var ev ndjsonEvent
+				if err := json.Unmarshal([]byte(line), &ev); err != nil {
+					t.Fatal(err)
+				}
+				if ev.Kind != "edge" {
+					continue
+				}
+				n++
+				ev.Label = ""
+				if seen[ev] {
+					t.Errorf("edge %s -> %s (%s) sent again", ev.From, ev.To, ev.Role)
+				}
+				seen[ev] = true
+			}
+			if n != want {
+				t.Errorf("%d edge events, want %d:\n%s", n, want, events)
+			}
+		})
+	}
+}
+
+// checkJSONEdges fails the test if an edge of the -format=json document out
+// leads from or to a node the document does not list.
+func checkJSONEdges(t *testing.T, out string) {
+	t.Helper()
+	var doc jsonGraph
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatal(err)
+	}
+	nodes := make(map[string]bool)
+	for _, n := range doc.Nodes {
+		nodes[n.ID] = true
+	}
+	for _, e := range doc.Edges {
+		if !nodes[e.Source] || !nodes[e.Target] {
+			t.Errorf("edge %s -> %s (%s) leads from or to a missing node", e.Source, e.Target, e.Role)
+		}
+	}
+}
+
+func TestMergeBaseCrissCross(t *testing.T) {
+	f := newFixture(t)
+	root := f.commit("root")
+	f.git("tag", "-a", "-m", "old", "vold", root)
+	f.git("branch", "old", root)
+	f.git("symbolic-ref", "refs/heads/sym", "refs/heads/old")
+	a := f.commit("a")
+	f.git("checkout", "-q", "-b", "side", root)
+	b := f.commit("b")
+	m1 := f.commitTree("m1", a, b)
+	m2 := f.commitTree("m2", b, a)
+	f.git("update-ref", "refs/heads/main", m1)
+	f.git("update-ref", "refs/heads/side", m2)
+	f.git("checkout", "-q", "main")
+	c := f.commit("c")
+	f.git("checkout", "-q", "side")
+	d := f.commit("d")
+	tag := f.git("rev-parse", "vold")
+
+	for _, format := range []string{"dot", "json"} {
+		t.Run(format, func(t *testing.T) {
+			opts := testOptions()
+			opts.format = format
+			opts.all = true
+			opts.mergeBase = true
+			out := f.render(opts, "refs/heads/main", "refs/heads/side")
+			for _, h := range []string{a, b, m1, m2, c, d, "refs/heads/main", "refs/heads/side"} {
+				if !strings.Contains(out, h) {
+					t.Errorf("%s is missing:\n%s", h, out)
+				}
+			}
+			for _, h := range []string{root, tag, "refs/heads/old", "refs/heads/sym", "refs/tags/vold"} {
+				if strings.Contains(out, h) {
+					t.Errorf("%s, below the merge bases, is drawn:\n%s", h, out)
+				}
+			}
+			if format == "json" {
+				checkJSONEdges(t, out)
+			} else {
+				// Both sides of the criss-cross are merge bases.
+				for _, h := range []string{a, b} {
+					if line := dotNode(out, h); !strings.Contains(line, `penwidth="2"`) {
+						t.Errorf("merge base %s is not highlighted: %s", h, line)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestExcludeReachableFrom(t *testing.T) {
+	f := newFixture(t)
+	base := f.commit("base")
+	f.git("checkout", "-q", "-b", "side")
+	side := f.commit("side")
+	f.git("tag", "-a", "-m", "vside", "vside", side)
+	tag := f.git("rev-parse", "vside")
+	f.git("checkout", "-q", "main")
+	main := f.commit("main")
+	f.git("checkout", "-q", "side")
+
+	for _, format := range []string{"dot", "json"} {
+		t.Run(format, func(t *testing.T) {
+			opts := testOptions()
+			opts.format = format
+			opts.excludeFrom = stringList{"refs/heads/side"}
+			out := f.render(opts)
+			if !strings.Contains(out, main) || !strings.Contains(out, "refs/heads/main") {
+				t.Errorf("main is missing:\n%s", out)
+			}
+			for _, h := range []string{base, side, tag, "refs/heads/side", "refs/tags/vside", `"HEAD"`} {
+				if strings.Contains(out, h) {
+					t.Errorf("%s, in the excluded history, is drawn:\n%s", h, out)
+				}
+			}
+			if format == "json" {
+				checkJSONEdges(t, out)
+			}
+		})
+	}
+}
+
+func TestChanged(t *testing.T) {
+	f := newFixture(t)
+	f.write("small", "small\n")
+	f.write("dir/large", strings.Repeat("large\n", 100))
+	root := f.commit("root")
+	f.write("small", "changed\n")
+	child := f.commit("child")
+	rev := func(c, p string) string { return f.git("rev-parse", c+":"+p) }
+
+	tests := []struct {
+		name        string
+		commit      string
+		maxBlobSize byteSize
+		want        []string
+		notWant     []string
+	}{
+		{
+			name:   "root commit",
+			commit: root,
+			want:   []string{root, rev(root, ""), rev(root, "dir"), rev(root, "small"), rev(root, "dir/large")},
+		},
+		{
+			name:        "root commit with large blobs excluded",
+			commit:      root,
+			maxBlobSize: 100,
+			want:        []string{root, rev(root, ""), rev(root, "small")},
+			notWant:     []string{rev(root, "dir/large")},
+		},
+		{
+			name:    "commit with a parent",
+			commit:  child,
+			want:    []string{child, root, rev(child, ""), rev(child, "small")},
+			notWant: []string{rev(root, ""), rev(root, "small"), rev(child, "dir"), rev(child, "dir/large")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.changed = tt.commit
+			opts.maxBlobSize = tt.maxBlobSize
+			out := f.render(opts)
+			for _, h := range tt.want {
+				if dotNode(out, h) == "" {
+					t.Errorf("%s is missing:\n%s", h, out)
+				}
+			}
+			for _, h := range tt.notWant {
+				if strings.Contains(out, h) {
+					t.Errorf("%s is drawn:\n%s", h, out)
+				}
+			}
+		})
+	}
+}
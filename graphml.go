@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// renderGraphML writes the graph as GraphML, recording each node's type and
+// label and each edge's role and label as data attributes.
+func renderGraphML(w io.Writer, g *graph, opts *options) error {
+	out := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "type", For: "node", AttrName: "type", AttrType: "string"},
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "role", For: "edge", AttrName: "role", AttrType: "string"},
+			{ID: "elabel", For: "edge", AttrName: "label", AttrType: "string"},
+		},
+		Graph: graphMLGraph{ID: "G", EdgeDefault: "directed"},
+	}
+	for _, set := range g.objectSets() {
+		for _, h := range set.hashes {
+			out.Graph.Nodes = append(out.Graph.Nodes, graphMLNode{
+				ID: h.String(),
+				Data: []graphMLData{
+					{Key: "type", Value: set.typ.String()},
+					{Key: "label", Value: abbrev(h, opts.abbrev)},
+				},
+			})
+		}
+	}
+	for _, name := range sortedRefNames(g.refs) {
+		out.Graph.Nodes = append(out.Graph.Nodes, graphMLNode{
+			ID: name,
+			Data: []graphMLData{
+				{Key: "type", Value: "ref"},
+				{Key: "label", Value: name},
+			},
+		})
+		if target, ok := g.refTarget(name); ok {
+			out.Graph.Edges = append(out.Graph.Edges, graphMLEdge{
+				Source: name,
+				Target: target,
+				Data:   []graphMLData{{Key: "role", Value: "ref"}},
+			})
+		}
+	}
+	for _, h := range sortedEdgeSources(g.edges) {
+		for _, e := range g.edges[h] {
+			data := []graphMLData{{Key: "role", Value: e.role.String()}}
+			if e.label != "" {
+				data = append(data, graphMLData{Key: "elabel", Value: e.label})
+			}
+			out.Graph.Edges = append(out.Graph.Edges, graphMLEdge{
+				Source: h.String(),
+				Target: e.target.String(),
+				Data:   data,
+			})
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
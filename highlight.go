@@ -0,0 +1,93 @@
+package main
+
+import (
+	"gopkg.in/src-d/go-git.v4"
+)
+
+// resolveHighlights records the objects named by -highlight, references or
+// full or abbreviated hashes, to be emphasized in the graph.
+func (g *graph) resolveHighlights(r *git.Repository) error {
+	for _, n := range g.opts.highlight {
+		h, err := resolveObject(r, n)
+		if err != nil {
+			return err
+		}
+		g.highlighted[h] = true
+	}
+	return nil
+}
+
+// nearHighlights returns the nodes, by name, within -highlight-radius edges
+// of a highlighted object, following edges either way. Every other node is
+// dimmed. It returns nil, dimming nothing, without -highlight-radius.
+func (g *graph) nearHighlights() map[string]bool {
+	for h := range g.highlighted {
+		if _, ok := g.nodes[h]; !ok {
+			warnf("-highlight %s: not in the graph", h)
+		}
+	}
+	if g.opts.highlightRadius < 0 {
+		return nil
+	}
+	adjacent := make(map[string][]string)
+	link := func(a, b string) {
+		adjacent[a] = append(adjacent[a], b)
+		adjacent[b] = append(adjacent[b], a)
+	}
+	for h, es := range g.edges {
+		for _, e := range es {
+			link(h.String(), e.target.String())
+		}
+	}
+	for name := range g.refs {
+		if target, ok := g.refTarget(name); ok {
+			link(name, target)
+		}
+	}
+	near := make(map[string]bool)
+	var frontier []string
+	for h := range g.highlighted {
+		near[h.String()] = true
+		frontier = append(frontier, h.String())
+	}
+	for i := 0; i < g.opts.highlightRadius && len(frontier) > 0; i++ {
+		var next []string
+		for _, n := range frontier {
+			for _, m := range adjacent[n] {
+				if !near[m] {
+					near[m] = true
+					next = append(next, m)
+				}
+			}
+		}
+		frontier = next
+	}
+	return near
+}
+
+// emphasize styles the node attrs: bold and outlined for a highlighted
+// object, or grayed out when dimmed is set.
+func emphasize(attrs map[string]string, highlighted, dimmed bool, opts *options) {
+	switch {
+	case highlighted:
+		attrs["penwidth"] = "3"
+		if !opts.noColor {
+			if c, ok := attrs["color"]; ok {
+				attrs["fillcolor"] = c
+			}
+			attrs["color"] = "black"
+		}
+	case dimmed:
+		attrs["fontcolor"] = "gray60"
+		attrs["color"] = "gray80"
+		if !opts.noColor {
+			attrs["fillcolor"] = "gray95"
+		}
+	}
+}
+
+// dimEdge grays out the edge attrs.
+func dimEdge(attrs map[string]string) {
+	attrs["fontcolor"] = "gray60"
+	attrs["color"] = "gray80"
+}
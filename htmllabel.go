@@ -0,0 +1,76 @@
+package main
+
+import (
+	"html"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// htmlMarker starts the attribute values that renderAttrs writes as
+// HTML-like strings, between < and >, rather than quoted. No escaped text
+// contains it.
+const htmlMarker = "\x00"
+
+// htmlValue returns the HTML-like string s as an attribute value.
+func htmlValue(s string) string {
+	return htmlMarker + s
+}
+
+// htmlCommitLabel returns the HTML-like label of the commit h for
+// -html-labels: a table of its type, its abbreviated hash in bold and its
+// subject in small print, and then a row for each line of extra, the text,
+// escaped for a quoted label, that other options add to the plain label.
+func (g *graph) htmlCommitLabel(h plumbing.Hash, extra string, opts *options) string {
+	var rows []string
+	if !opts.noTypes {
+		rows = append(rows, `<FONT POINT-SIZE="10" COLOR="gray30">commit</FONT>`)
+	}
+	rows = append(rows, "<B>"+abbrev(h, opts.abbrev)+"</B>")
+	if ci, ok := g.info[h]; ok {
+		if subject := strings.SplitN(ci.message, "\n", 2)[0]; subject != "" {
+			rows = append(rows, `<FONT POINT-SIZE="10">`+htmlLines(wrapText(subject, opts.labelWrap))+"</FONT>")
+		}
+	}
+	for _, l := range strings.Split(unescapeLabel(extra), "\n") {
+		if l != "" {
+			rows = append(rows, htmlLines(l))
+		}
+	}
+	var b strings.Builder
+	b.WriteString(`<TABLE BORDER="0" CELLBORDER="0" CELLSPACING="0">`)
+	for _, r := range rows {
+		b.WriteString("<TR><TD>" + r + "</TD></TR>")
+	}
+	b.WriteString("</TABLE>")
+	return b.String()
+}
+
+// htmlLines escapes s for an HTML-like label, breaking it at its newlines.
+func htmlLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = html.EscapeString(l)
+	}
+	return strings.Join(lines, "<BR/>")
+}
+
+// unescapeLabel undoes escapeLabel, turning the \n line breaks of a quoted
+// label back into newlines.
+func unescapeLabel(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
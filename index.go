@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// walkIndex walks the tree staged in the index of r as if a reference named
+// INDEX pointed at it. The index only lists files, so its trees are built in
+// memory, as git write-tree would build them, without touching the
+// repository.
+func (g *graph) walkIndex(ctx context.Context, r *git.Repository) error {
+	if _, err := r.Worktree(); err != nil {
+		return fmt.Errorf("-index: %v", err)
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("-index: %v", err)
+	}
+	mem := memory.NewStorage()
+	h, err := writeIndexTree(mem, idx)
+	if err != nil {
+		return fmt.Errorf("-index: %v", err)
+	}
+	s := &alternateStorer{Storer: r.Storer, alternates: []storer.EncodedObjectStorer{mem}}
+	return g.walkRef(ctx, s, plumbing.NewHashReference("INDEX", h))
+}
+
+// indexDir is a directory of the index, holding the entries of the tree that
+// will be built for it.
+type indexDir struct {
+	entries []object.TreeEntry
+	dirs    map[string]*indexDir
+}
+
+// writeIndexTree stores the trees of the entries in idx in s and returns the
+// hash of the root tree.
+func writeIndexTree(s storer.EncodedObjectStorer, idx *index.Index) (plumbing.Hash, error) {
+	root := &indexDir{dirs: make(map[string]*indexDir)}
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			return plumbing.ZeroHash, fmt.Errorf("%s: unmerged", e.Name)
+		}
+		d := root
+		dir, name := path.Split(e.Name)
+		for _, p := range strings.Split(strings.TrimSuffix(dir, "/"), "/") {
+			if p == "" {
+				continue
+			}
+			sub, ok := d.dirs[p]
+			if !ok {
+				sub = &indexDir{dirs: make(map[string]*indexDir)}
+				d.dirs[p] = sub
+			}
+			d = sub
+		}
+		d.entries = append(d.entries, object.TreeEntry{Name: name, Mode: e.Mode, Hash: e.Hash})
+	}
+	return root.write(s)
+}
+
+func (d *indexDir) write(s storer.EncodedObjectStorer) (plumbing.Hash, error) {
+	entries := d.entries
+	for name, sub := range d.dirs {
+		h, err := sub.write(s)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: h})
+	}
+	// Git sorts tree entries as if the names of subtrees ended in a slash.
+	key := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return key(entries[i]) < key(entries[j])
+	})
+	obj := s.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(obj)
+}
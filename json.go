@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonSchemaVersion is the schemaVersion of the documents written by
+// -format=json. It is bumped whenever a field is removed, renamed or changes
+// meaning, so consumers can refuse documents they do not understand; new
+// fields may be added without bumping it.
+const jsonSchemaVersion = 1
+
+// jsonGraph is the document written by -format=json.
+type jsonGraph struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	Nodes         []jsonNode `json:"nodes"`
+	Edges         []jsonEdge `json:"edges"`
+}
+
+// jsonNode is an object, identified by its full hash, or a reference,
+// identified by its full name. Type is tag, commit, tree, blob, missing,
+// corrupt or ref.
+type jsonNode struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// jsonEdge links the nodes with the IDs Source and Target. Role is ref,
+// target, parent, tree or entry, and Label holds the entry names of tree
+// edges when they are labeled.
+type jsonEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Role   string `json:"role"`
+	Label  string `json:"label,omitempty"`
+}
+
+// renderJSON writes the graph as a JSON document listing every node, keyed
+// by object hash or reference name, and every edge between them. The
+// document is compact unless -pretty is given.
+func renderJSON(w io.Writer, g *graph, opts *options) error {
+	out := jsonGraph{SchemaVersion: jsonSchemaVersion, Nodes: []jsonNode{}, Edges: []jsonEdge{}}
+	for _, set := range g.objectSets() {
+		for _, h := range set.hashes {
+			out.Nodes = append(out.Nodes, jsonNode{ID: h.String(), Type: set.typ.String()})
+		}
+	}
+	for _, name := range sortedRefNames(g.refs) {
+		out.Nodes = append(out.Nodes, jsonNode{ID: name, Type: "ref"})
+		if target, ok := g.refTarget(name); ok {
+			out.Edges = append(out.Edges, jsonEdge{Source: name, Target: target, Role: "ref"})
+		}
+	}
+	for _, h := range sortedEdgeSources(g.edges) {
+		for _, e := range g.edges[h] {
+			out.Edges = append(out.Edges, jsonEdge{
+				Source: h.String(),
+				Target: e.target.String(),
+				Role:   e.role.String(),
+				Label:  e.label,
+			})
+		}
+	}
+	enc := json.NewEncoder(w)
+	if opts.pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(out)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// defaultLabelTemplate is the -label-template equivalent of the labels drawn
+// without one.
+const defaultLabelTemplate = "{{.Type}}\n{{.ShortHash}}"
+
+// labelData is what a -label-template is executed with for each object node.
+// The commit fields are empty for other objects.
+type labelData struct {
+	Hash      string
+	ShortHash string
+	Type      string
+
+	Subject string
+	Author  string
+	Date    string
+}
+
+// parseLabelTemplate parses a -label-template and executes it once on empty
+// data, so mistakes such as unknown fields are reported before the walk
+// rather than on every node.
+func parseLabelTemplate(text string) (*template.Template, error) {
+	t, err := template.New("label").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(ioutil.Discard, labelData{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// nodeLabel returns the DOT label of the object h of type t, from the
+// -label-template if one is given.
+func (g *graph) nodeLabel(h plumbing.Hash, t string, opts *options) string {
+	if opts.labelTemplate == nil {
+		return label(h, t, opts)
+	}
+	return escapeLabel(wrapText(g.templateLabel(h, opts), opts.labelWrap))
+}
+
+// templateLabel executes the -label-template for the object h, returning the
+// unescaped text. The template has already run once without error, so an
+// error now falls back to the abbreviated hash.
+func (g *graph) templateLabel(h plumbing.Hash, opts *options) string {
+	d := labelData{
+		Hash:      h.String(),
+		ShortHash: abbrev(h, opts.abbrev),
+	}
+	if t, ok := g.nodes[h]; ok {
+		d.Type = t.String()
+	}
+	if ci, ok := g.info[h]; ok {
+		d.Subject = strings.SplitN(ci.message, "\n", 2)[0]
+		d.Author = ci.author.Name
+		if !ci.author.When.IsZero() {
+			d.Date = ci.author.When.Format("2006-01-02 15:04:05 -0700")
+		}
+	}
+	var b bytes.Buffer
+	if err := opts.labelTemplate.Execute(&b, d); err != nil {
+		return d.ShortHash
+	}
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// logLevel is the amount of diagnostic logging written to stderr.
+type logLevel int
+
+const (
+	logQuiet logLevel = iota
+	logInfo           // -verbose: objects decoded and objects filtered out
+	logDebug          // -vv: also every edge added and every repeat visit
+)
+
+var (
+	verbosity = logQuiet
+	logger    = log.New(os.Stderr, "git-graphviz: ", 0)
+)
+
+// warnf logs a note that something in the repository may not be graphed as
+// expected, whatever the verbosity.
+func warnf(format string, args ...interface{}) {
+	logger.Printf(format, args...)
+}
+
+// infof logs a traversal diagnostic when running with -verbose or -vv.
+func infof(format string, args ...interface{}) {
+	if verbosity >= logInfo {
+		logger.Printf(format, args...)
+	}
+}
+
+// debugf logs a detailed traversal diagnostic when running with -vv.
+func debugf(format string, args ...interface{}) {
+	if verbosity >= logDebug {
+		logger.Printf(format, args...)
+	}
+}
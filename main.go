@@ -1,27 +1,31 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"gopkg.in/src-d/go-billy.v4/osfs"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
-	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
-	"gopkg.in/src-d/go-git.v4/plumbing/object"
-	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 )
 
-var (
-	refs    = make(map[string]*plumbing.Reference)
-	tags    = make(map[plumbing.Hash]bool)
-	commits = make(map[plumbing.Hash]bool)
-	trees   = make(map[plumbing.Hash]bool)
-	blobs   = make(map[plumbing.Hash]bool)
-	edges   = make(map[plumbing.Hash][]plumbing.Hash)
+const (
+	defaultAbbrev = 6
+	minAbbrev     = 4
 )
 
 type options struct {
@@ -29,265 +33,776 @@ type options struct {
 	noTypes  bool
 	noRefs   bool
 	dangling bool
+	all      bool
+	output   string
+	format   string
+	watch    bool
+	abbrev   int
+
+	flattenTrees bool
+	include      stringList
+	topoOrder    bool
+	noBlobEdges  bool
+	title        string
+	caption      bool
+	byExtension  bool
+	bundleEdges  bool
+	treeAsRecord bool
+	anonymize    bool
+	noPrune      bool
+	alternates   stringList
+	maxBlobSize  byteSize
+	timeOrder    bool
+	tagChase     bool
+	strict       bool
+	noIsolated   bool
+	pack         string
+
+	colorizeByRef  bool
+	only           typeSet
+	excludeType    typeSet
+	tooltips       bool
+	urlTemplate    string
+	refEdgeStyle   bool
+	index          bool
+	mergeBase      bool
+	clusterByRef   bool
+	timeout        time.Duration
+	decorate       string
+	excludeFrom    stringList
+	showEntryOrder bool
+	maxParents     int
+	arrowheads     bool
+	splitByRef     bool
+	typeComments   bool
+	collapseBlobs  bool
+	refKindColors  bool
+	perArg         bool
+	outputDir      string
+	scalePenwidth  bool
+
+	colorByEmailDomain bool
+	nodesep            float64
+	ranksep            float64
+	changed            string
+	labelTemplate      *template.Template
+	pretty             bool
+	stash              bool
+	excludePaths       stringList
+	splines            string
+	compactMerges      bool
+	deterministic      bool
+	provenance         []string
+	followRenames      bool
+	alignSiblings      bool
+	pruneToRefs        bool
+	labelWrap          int
+	colorEdgesByAge    bool
+	allowShallow       bool
+	useCommitGraph     bool
+	rankByGeneration   bool
+	ignoreObjectErrors bool
+	head               bool
+	sortCommitsBy      string
+	urlCommit          string
+	urlTree            string
+	urlBlob            string
+	highlight          stringList
+	highlightRadius    int
+	mainlineWeight     int
+	stats              string
+	graphAttrs         attrList
+	nodeAttrs          attrList
+	edgeAttrs          attrList
+	excludeMerges      bool
+	fsck               bool
+	htmlLabels         bool
+	packIndex          *idxfile.MemoryIndex
+	sinceTag           string
+	clusterByDir       bool
 }
 
-func main() {
-	opts := &options{}
-	flag.BoolVar(&opts.noColor, "no-color", false, "suppress filling graph nodes with color")
-	flag.BoolVar(&opts.noTypes, "no-types", false, "suppress labeling graph nodes with git object types")
-	flag.BoolVar(&opts.noRefs, "no-refs", false, "suppress including references in the graph")
-	flag.BoolVar(&opts.dangling, "dangling", false, "include dangling objects in the graph")
-	flag.Parse()
+// stringList is a flag.Value collecting each occurrence of a repeatable flag.
+type stringList []string
 
-	r, err := repo()
-	check(err)
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
-	if flag.NArg() > 0 {
-		for _, n := range flag.Args() {
-			ref, err := r.Reference(plumbing.ReferenceName(n), false)
-			if err != nil {
-				// Try decoding argument as hash
-				h := plumbing.NewHash(n)
-				if err := r.Storer.HasEncodedObject(h); err == nil {
-					check(walk(r.Storer, h))
-					continue
-				}
-				check(err)
-			}
-			check(walkRef(r.Storer, ref))
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// byteSize is a flag.Value holding a size in bytes, written either as a plain
+// number or with a k, m or g suffix for binary multiples, like git's own
+// size options.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(v string) error {
+	s := strings.TrimSuffix(strings.ToLower(v), "b")
+	s = strings.TrimSuffix(s, "i")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k':
+			mult = 1 << 10
+		case 'm':
+			mult = 1 << 20
+		case 'g':
+			mult = 1 << 30
 		}
-	} else {
-		if opts.dangling {
-			objs, err := r.Storer.IterEncodedObjects(plumbing.AnyObject)
-			check(err)
-			check(objs.ForEach(func(obj plumbing.EncodedObject) error {
-				return walkObj(r.Storer, obj)
-			}))
+		if mult > 1 {
+			s = s[:n-1]
 		}
-		refs, err := r.References()
-		check(err)
-		check(refs.ForEach(func(ref *plumbing.Reference) error {
-			return walkRef(r.Storer, ref)
-		}))
 	}
-
-	render(opts)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", v)
+	}
+	*b = byteSize(n * mult)
+	return nil
 }
 
-func repo() (*git.Repository, error) {
-	if gitdir, ok := os.LookupEnv("GIT_DIR"); ok {
-		dotgit, err := filesystem.NewStorage(osfs.New(gitdir))
-		if err != nil {
-			return nil, err
+// typeSet is a flag.Value holding a set of object types, given as a comma
+// separated list of their names.
+type typeSet map[objectType]bool
+
+func (t *typeSet) String() string {
+	var names []string
+	for _, typ := range objectTypes {
+		if (*t)[typ] {
+			names = append(names, typ.String())
 		}
-		return git.Open(dotgit, osfs.New(os.Getenv("GIT_WORK_TREE")))
 	}
-	dir, err := os.Getwd()
-	if err != nil {
-		return nil, err
+	return strings.Join(names, ",")
+}
+
+func (t *typeSet) Set(v string) error {
+	if *t == nil {
+		*t = make(typeSet)
 	}
-	return git.PlainOpen(dir)
+	var names []string
+	for _, typ := range objectTypes {
+		names = append(names, typ.String())
+	}
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, typ := range objectTypes {
+			if name == typ.String() {
+				(*t)[typ] = true
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown object type %q, want one of %s", name, strings.Join(names, ", "))
+		}
+	}
+	return nil
 }
 
-func check(err error) {
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "git-graphviz: Error: %v\n", err)
-		os.Exit(1)
+// attrList is a flag.Value collecting Graphviz attributes given as
+// key=value by a repeatable flag. A later value for a key replaces an earlier
+// one.
+type attrList map[string]string
+
+// attrName matches the attribute names Graphviz accepts unquoted.
+var attrName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (a *attrList) String() string {
+	var as []string
+	for k, v := range *a {
+		as = append(as, k+"="+v)
 	}
+	sort.Strings(as)
+	return strings.Join(as, ",")
 }
 
-func walkRef(s storer.Storer, ref *plumbing.Reference) error {
-	name := string(ref.Name())
-	if _, ok := refs[name]; ok {
-		return nil
+func (a *attrList) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i < 0 {
+		return fmt.Errorf("%q is not key=value", v)
 	}
-	refs[name] = ref
-	if ref.Type() == plumbing.HashReference {
-		return walk(s, ref.Hash())
+	if !attrName.MatchString(v[:i]) {
+		return fmt.Errorf("invalid attribute name %q", v[:i])
 	}
-	target, err := s.Reference(ref.Target())
-	if err != nil {
-		return nil
+	if *a == nil {
+		*a = make(attrList)
 	}
-	return walkRef(s, target)
+	(*a)[v[:i]] = v[i+1:]
+	return nil
 }
 
-func walk(s storer.EncodedObjectStorer, h plumbing.Hash) error {
-	for _, seen := range []map[plumbing.Hash]bool{tags, commits, trees, blobs} {
-		if seen[h] {
-			return nil
+func main() {
+	opts := &options{}
+	flag.BoolVar(&opts.noColor, "no-color", false, "suppress filling graph nodes with color")
+	flag.BoolVar(&opts.noTypes, "no-types", false, "suppress labeling graph nodes with git object types")
+	flag.BoolVar(&opts.noRefs, "no-refs", false, "suppress including references in the graph")
+	flag.BoolVar(&opts.dangling, "dangling", false, "include dangling objects when walking all references")
+	flag.BoolVar(&opts.all, "all", false, "walk every reference, in addition to any arguments")
+	everything := flag.Bool("everything", false, "walk every reference and every object in the repository, reachable or not (-all -dangling)")
+	flag.StringVar(&opts.output, "output", "", "write the graph to `file` instead of stdout, which - also names")
+	flag.StringVar(&opts.format, "format", "dot", "output `format`: "+strings.Join(formatNames(), ", ")+" (defaults to the -output file extension)")
+	flag.BoolVar(&opts.watch, "watch", false, "re-render the graph to the -output file whenever the repository changes")
+	flag.IntVar(&opts.abbrev, "abbrev", defaultAbbrev, "abbreviate object names in labels to `n` hex digits (defaults to core.abbrev)")
+	flag.BoolVar(&opts.flattenTrees, "flatten-trees", false, "omit tree nodes and link commits directly to the blobs in their tree, labeled by path")
+	flag.Var(&opts.include, "include-object", "also walk the object named by `hash`, which may be abbreviated (repeatable)")
+	flag.BoolVar(&opts.topoOrder, "topo-order", false, "rank commits of the same generation together so ancestry reads in order (dot engine only)")
+	flag.BoolVar(&opts.noBlobEdges, "no-blob-edges", false, "declare blob nodes but omit the edges leading to them")
+	flag.StringVar(&opts.title, "title", "", "label the graph with `text`")
+	flag.BoolVar(&opts.caption, "caption", false, "label the graph with the number of objects of each type")
+	flag.BoolVar(&opts.byExtension, "by-extension", false, "label and color blobs by the extension of the file name they are stored under")
+	flag.BoolVar(&opts.bundleEdges, "bundle-edges", false, "merge edges that share endpoints into bundles (sets concentrate=true)")
+	flag.BoolVar(&opts.treeAsRecord, "tree-as-record", false, "render each tree as a record listing its entries, with blobs shown inline")
+	flag.BoolVar(&opts.anonymize, "anonymize", false, "replace object hashes with random pseudonyms and omit file names, so the graph can be shared")
+	flag.BoolVar(&opts.noPrune, "no-prune", false, "keep trees and blobs left without incoming edges after filtering (for debugging)")
+	flag.Var(&opts.alternates, "alternate", "also read objects from the object `dir`ectory of another repository (repeatable)")
+	flag.Var(&opts.maxBlobSize, "exclude-blobs-larger-than", "omit blobs larger than `size` bytes; k, m and g suffixes are accepted")
+	flag.BoolVar(&opts.timeOrder, "time-order", false, "declare commits oldest first and, with -topo-order, lay out each rank left to right by committer date (dot engine only; the group=commits hint still pulls commits into a column)")
+	flag.BoolVar(&opts.tagChase, "tag-chase", false, "point tags directly at the object at the end of a chain of tags, omitting the tags in between")
+	flag.BoolVar(&opts.strict, "strict", false, "emit a strict digraph, in which Graphviz merges multiple edges between the same nodes into one")
+	flag.BoolVar(&opts.noIsolated, "no-isolated", false, "omit objects with no edges to or from any other node, unless named by an argument or -include-object")
+	flag.StringVar(&opts.pack, "pack", "", "graph the objects in the packfile at `path`, located through its .idx, instead of the repository; objects they reference outside the pack are shown as missing")
+	flag.BoolVar(&opts.colorizeByRef, "colorize-by-ref", false, "color each branch and tint commits by the first branch, in name order, they are reachable from")
+	flag.Var(&opts.only, "only", "keep only objects of the comma separated `types`, along with the edges between them")
+	flag.Var(&opts.excludeType, "exclude-type", "omit objects of the comma separated `types` and their edges; applied after -only")
+	flag.BoolVar(&opts.tooltips, "tooltips", false, "give each object node its full hash as a tooltip")
+	flag.StringVar(&opts.urlTemplate, "url-template", "", "link each object node to `url`, in which {hash} is replaced by the object's full hash; with -format=cmapx and -output, the PNG the image map belongs to is written beside it")
+	interactiveSVG := flag.Bool("interactive-svg", false, "render a clickable SVG with tooltips and links (-format=svg -tooltips; requires -url-template)")
+	flag.BoolVar(&opts.refEdgeStyle, "ref-edge-style", false, "draw reference edges dashed, in the reference's color, and without constraining the layout (constraint=false)")
+	flag.BoolVar(&opts.index, "index", false, "also walk the tree staged in the index, shown as a reference named INDEX")
+	flag.BoolVar(&opts.mergeBase, "merge-base", false, "graph only the history of the two commits named by the arguments down to their merge bases, which are highlighted")
+	flag.BoolVar(&opts.clusterByRef, "cluster-by-ref", false, "group the commits reachable from only one branch into a cluster for that branch")
+	flag.DurationVar(&opts.timeout, "timeout", 0, "give up if walking the repository takes longer than `duration`")
+	flag.StringVar(&opts.decorate, "decorate", "boxes", "show references as separate `boxes`, as labels on the objects they point at, or both")
+	flag.Var(&opts.excludeFrom, "exclude-reachable-from", "omit the commits reachable from the reference or commit `name`, like ^name in git log (repeatable)")
+	flag.BoolVar(&opts.showEntryOrder, "show-entry-order", false, "number the edges from each tree in git's canonical order of its entries, in which subtrees sort as if their names ended in a slash")
+	flag.IntVar(&opts.maxParents, "max-parents", 0, "draw and walk at most `n` parents of each commit, noting how many more there are (0 means no limit)")
+	flag.BoolVar(&opts.arrowheads, "arrowheads", false, "distinguish edges by arrowhead: empty for references, vee for tags, normal for parents and dot for trees and their entries")
+	flag.BoolVar(&opts.splitByRef, "split-by-ref", false, "write a separate graph of the history of each branch and tag to a file named after it in the -output directory")
+	flag.BoolVar(&opts.typeComments, "type-comments", false, "set the comment attribute of each node to its type, for tools that post-process DOT")
+	flag.BoolVar(&opts.collapseBlobs, "collapse-blobs-into-trees", false, "like -tree-as-record, but also show the size of each blob in its tree's record")
+	flag.BoolVar(&opts.refKindColors, "color-refs-by-kind", false, "color HEAD, branches, tags, remote-tracking branches and notes or stashes differently, or with -no-color give them different shapes")
+	flag.BoolVar(&opts.perArg, "per-arg", false, "walk each argument separately, writing its graph to a file named after it in the -output-dir directory")
+	flag.StringVar(&opts.outputDir, "output-dir", "", "write the graphs of -per-arg into `directory`")
+	flag.BoolVar(&opts.scalePenwidth, "scale-penwidth", false, "draw the border of each blob thicker the larger it is, and of each commit the more files it changes")
+	flag.BoolVar(&opts.colorByEmailDomain, "color-by-email-domain", false, "color each commit by the domain of its author's email address, logging the colors of the domains to stderr")
+	flag.Float64Var(&opts.nodesep, "nodesep", 0, "set the Graphviz nodesep graph attribute, the minimum space between nodes of a rank, to `inches`")
+	flag.Float64Var(&opts.ranksep, "ranksep", 0, "set the Graphviz ranksep graph attribute, the minimum space between ranks, to `inches`")
+	flag.StringVar(&opts.changed, "changed", "", "graph only `commit`, its first parent, and the trees and blobs it adds or modifies")
+	labelTemplate := flag.String("label-template", "", "label object nodes by executing the Go text/template `text` with .Hash, .ShortHash, .Type and, for commits, .Subject, .Author and .Date (the default labels are "+strconv.Quote(defaultLabelTemplate)+")")
+	flag.BoolVar(&opts.pretty, "pretty", false, "indent -format=json output for reading, rather than writing it compactly")
+	flag.BoolVar(&opts.stash, "stash", false, "also walk refs/stash and the earlier stash entries in its reflog, labeling the parents of each stash commit")
+	flag.Var(&opts.excludePaths, "exclude-path", "omit the tree entries whose path matches `glob`, and everything beneath them; a glob without a slash matches names at any depth (repeatable)")
+	flag.StringVar(&opts.splines, "splines", "", "set the Graphviz splines graph attribute, how edges are drawn: `style` is none, line, polyline, curved, ortho, spline, true or false")
+	flag.BoolVar(&opts.compactMerges, "compact-merges", false, "omit the trees and blobs of merge commits, and the edges to them, while walking those of other commits")
+	flag.BoolVar(&opts.deterministic, "deterministic", false, "leave the generation time out of the comment block at the start of DOT output, so the same repository always gives the same output")
+	flag.BoolVar(&opts.followRenames, "follow-renames", false, fmt.Sprintf("label the edge to each file a commit renamed, unchanged, from its first parent with the old path; this diffs every commit against its parent, so it is skipped for graphs of more than %d commits", followRenamesLimit))
+	flag.BoolVar(&opts.alignSiblings, "align-siblings", false, "lay out the commits that share a parent side by side, using invisible edges that change positions but not the graph (dot engine only)")
+	flag.BoolVar(&opts.pruneToRefs, "prune-to-refs", false, "after all other filtering, omit the objects no longer reachable from a reference or an argument")
+	flag.IntVar(&opts.labelWrap, "label-wrap", 0, "wrap commit messages, author names and reference names in labels at `n` characters, on word boundaries where possible (0 means no wrapping)")
+	flag.BoolVar(&opts.colorEdgesByAge, "color-edges-by-age", false, "color the edges from each commit to its parents from blue for the oldest commit to red for the newest, by committer date, logging the dates to stderr")
+	flag.BoolVar(&opts.allowShallow, "allow-shallow", false, "in a shallow clone, stop at the boundary commits, whose parents are missing, and draw them dashed")
+	flag.BoolVar(&opts.useCommitGraph, "use-commit-graph", false, "read commits from the commit-graph file, when there is one, instead of decoding them, if only their parents are needed (as with -only=commit)")
+	flag.BoolVar(&opts.rankByGeneration, "rank-by-generation", false, "rank commits by the generation numbers in the commit-graph file, when there is one, instead of computing them as -topo-order does (dot engine only)")
+	flag.BoolVar(&opts.ignoreObjectErrors, "ignore-errors-per-object", false, "log objects that cannot be read, draw them as corrupt and carry on, exiting with an error once the graph is written")
+	flag.BoolVar(&opts.head, "head", false, "walk from HEAD, as if it were given as an argument, failing if HEAD has no commits yet")
+	flag.StringVar(&opts.sortCommitsBy, "sort-commits-by", "hash", "declare commits in `order` of hash, date (oldest first) or topo (parents before children); declaration order is only a hint to the layout, not a constraint")
+	flag.StringVar(&opts.urlCommit, "url-commit", "", "link commit nodes to `url` instead of -url-template, with {hash} replaced as there")
+	flag.StringVar(&opts.urlTree, "url-tree", "", "link tree nodes to `url` instead of -url-template, with {hash} replaced as there and {path} by the tree's path, if known")
+	flag.StringVar(&opts.urlBlob, "url-blob", "", "link blob nodes to `url` instead of -url-template, with {hash} replaced as there and {path} by the blob's path, if known")
+	flag.Var(&opts.highlight, "highlight", "draw the object named by `ref or hash` in bold; may be repeated")
+	flag.IntVar(&opts.highlightRadius, "highlight-radius", -1, "with -highlight, gray out the nodes more than `n` edges from a highlighted object, following edges either way")
+	flag.IntVar(&opts.mainlineWeight, "mainline-weight", 0, "set the `weight` of edges from commits to their first parents, so the dot engine keeps first-parent history short and straight (dot engine only; other engines ignore it)")
+	flag.StringVar(&opts.stats, "stats", "", "after walking, write the number of commits in the graph by each author to stderr, most first, as a `table` or json")
+	flag.Var(&opts.graphAttrs, "graph-attr", "set the Graphviz graph attribute `key=value`, overriding any set by other flags (repeatable)")
+	flag.Var(&opts.nodeAttrs, "node-attr", "set the Graphviz attribute `key=value` in the default node statement; attributes set on a node override it (repeatable)")
+	flag.Var(&opts.edgeAttrs, "edge-attr", "set the Graphviz attribute `key=value` in the default edge statement; attributes set on an edge override it (repeatable)")
+	flag.BoolVar(&opts.excludeMerges, "exclude-merges", false, "omit merge commits, linking their children and references to their first parents instead; history merged in by their other parents is only walked if reachable some other way")
+	flag.BoolVar(&opts.fsck, "fsck", false, "check the repository as it is graphed, logging broken references, missing objects and dangling commits, reachable from no reference, to stderr; missing objects are drawn in the graph, and dangling commits dotted if they are in it")
+	flag.BoolVar(&opts.htmlLabels, "html-labels", false, "label commits with Graphviz HTML-like labels, a table of their type, their hash in bold and their subject in small print")
+	inPack := flag.String("only-objects-in-pack", "", "walk as usual, but gray out the objects that are not in the packfile whose index is at `path`, so those loose or in other packs stand out from it")
+	flag.StringVar(&opts.sinceTag, "since-tag", "", "graph only what is new since `tag`: omit the commits reachable from it, as -exclude-reachable-from does, and walk from HEAD if no arguments or -all are given")
+	flag.BoolVar(&opts.clusterByDir, "cluster-by-dir", false, "group the trees and blobs under each top-level directory into a cluster for it; an object under several is placed with the first by name, and its label names the others")
+	verbose := flag.Bool("verbose", false, "log objects decoded and skipped during the walk to stderr")
+	vv := flag.Bool("vv", false, "like -verbose, but also log every edge and repeat visit")
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showVersion {
+		printVersion(os.Stdout)
+		return
+	}
+
+	switch {
+	case *vv:
+		verbosity = logDebug
+	case *verbose:
+		verbosity = logInfo
+	}
+	if opts.collapseBlobs {
+		opts.treeAsRecord = true
+	}
+	if *everything {
+		opts.all = true
+		opts.dangling = true
+	}
+	if opts.output == "-" {
+		// Like most filters, take - to mean standard output.
+		if opts.watch || opts.splitByRef {
+			check(fmt.Errorf("-watch and -split-by-ref cannot write to standard output"))
 		}
+		opts.output = ""
 	}
-	obj, err := s.EncodedObject(plumbing.AnyObject, h)
-	if err != nil {
-		return fmt.Errorf("walk %s: %v", h, err)
+	if !isFlagSet("format") && opts.output != "" {
+		opts.format = formatFor(opts.output)
+	}
+	if *interactiveSVG {
+		if !hasURLs(opts) {
+			check(fmt.Errorf("-interactive-svg requires -url-template, -url-commit, -url-tree or -url-blob"))
+		}
+		if isFlagSet("format") && opts.format != "svg" {
+			check(fmt.Errorf("-interactive-svg cannot be used with -format=%s", opts.format))
+		}
+		opts.format = "svg"
+		opts.tooltips = true
+	}
+	if *labelTemplate != "" {
+		t, err := parseLabelTemplate(*labelTemplate)
+		check(err)
+		opts.labelTemplate = t
+	}
+	for _, glob := range opts.excludePaths {
+		if _, err := path.Match(glob, ""); err != nil {
+			check(fmt.Errorf("-exclude-path %q: %v", glob, err))
+		}
+	}
+	if *inPack != "" {
+		idx, err := readPackIndex(*inPack)
+		check(err)
+		opts.packIndex = idx
+	}
+	if opts.htmlLabels && opts.labelTemplate != nil {
+		check(fmt.Errorf("-html-labels cannot be used with -label-template"))
+	}
+	if opts.alignSiblings && opts.topoOrder {
+		check(fmt.Errorf("-align-siblings cannot be used with -topo-order"))
+	}
+	if opts.rankByGeneration && (opts.topoOrder || opts.alignSiblings) {
+		check(fmt.Errorf("-rank-by-generation cannot be used with -topo-order or -align-siblings"))
+	}
+	if isFlagSet("highlight-radius") && (len(opts.highlight) == 0 || opts.highlightRadius < 0) {
+		check(fmt.Errorf("-highlight-radius requires -highlight and must not be negative"))
+	}
+	if isFlagSet("mainline-weight") && opts.mainlineWeight < 1 {
+		check(fmt.Errorf("-mainline-weight must be a positive integer"))
+	}
+	switch opts.stats {
+	case "", "table", "json":
+	default:
+		check(fmt.Errorf("-stats must be table or json"))
+	}
+	if opts.stats != "" && opts.anonymize {
+		check(fmt.Errorf("-stats cannot be used with -anonymize"))
+	}
+	if opts.labelWrap < 0 {
+		check(fmt.Errorf("-label-wrap must not be negative"))
+	}
+	switch {
+	case !commitOrders[opts.sortCommitsBy]:
+		check(fmt.Errorf("-sort-commits-by must be one of hash, date or topo"))
+	case opts.timeOrder && !isFlagSet("sort-commits-by"):
+		opts.sortCommitsBy = "date"
+	case opts.timeOrder && opts.sortCommitsBy != "date":
+		check(fmt.Errorf("-time-order declares commits by date, and cannot be used with -sort-commits-by=%s", opts.sortCommitsBy))
+	}
+	if opts.splines != "" && !splineStyles[opts.splines] {
+		check(fmt.Errorf("-splines must be one of none, line, polyline, curved, ortho, spline, true or false"))
+	}
+	if isFlagSet("nodesep") && !(opts.nodesep > 0) {
+		check(fmt.Errorf("-nodesep must be a positive number"))
+	}
+	if isFlagSet("ranksep") && !(opts.ranksep > 0) {
+		check(fmt.Errorf("-ranksep must be a positive number"))
+	}
+	if opts.format == "cmapx" && !hasURLs(opts) {
+		check(fmt.Errorf("-format=cmapx requires -url-template, -url-commit, -url-tree or -url-blob"))
+	}
+	switch opts.decorate {
+	case "boxes", "labels", "both":
+	default:
+		check(fmt.Errorf("-decorate must be boxes, labels or both"))
+	}
+	_, render := renderers[opts.format]
+	_, stream := streamers[opts.format]
+	if !render && !stream {
+		path, ok := findPlugin(opts.format)
+		if !ok {
+			check(fmt.Errorf("unknown format %q; supported formats are %s, or any for which a %s<format> program is on the PATH", opts.format, strings.Join(formatNames(), ", "), pluginPrefix))
+		}
+		renderers[opts.format] = external(path)
+	}
+	if opts.clusterByDir && opts.anonymize {
+		check(fmt.Errorf("-cluster-by-dir cannot be used with -anonymize, which omits file names"))
+	}
+	if stream && opts.anonymize {
+		check(fmt.Errorf("-anonymize cannot be used with -format=%s", opts.format))
+	}
+	if stream && opts.followRenames {
+		check(fmt.Errorf("-follow-renames cannot be used with -format=%s", opts.format))
+	}
+	if stream && opts.mergeBase {
+		check(fmt.Errorf("-merge-base cannot be used with -format=%s", opts.format))
+	}
+	if stream && opts.excludeMerges {
+		check(fmt.Errorf("-exclude-merges cannot be used with -format=%s", opts.format))
+	}
+	if stream && opts.packIndex != nil {
+		check(fmt.Errorf("-only-objects-in-pack cannot be used with -format=%s", opts.format))
+	}
+	if stream && opts.ignoreObjectErrors {
+		check(fmt.Errorf("-ignore-errors-per-object cannot be used with -format=%s", opts.format))
+	}
+	if stream && (len(opts.only) > 0 || len(opts.excludeType) > 0) {
+		check(fmt.Errorf("-only and -exclude-type cannot be used with -format=%s", opts.format))
+	}
+	// Streams write nodes and edges as they are found, before any of the
+	// filters that look at the whole graph could leave them out.
+	if stream && (opts.noIsolated || opts.pruneToRefs) {
+		check(fmt.Errorf("-no-isolated and -prune-to-refs cannot be used with -format=%s", opts.format))
+	}
+	if stream && opts.decorate != "boxes" {
+		check(fmt.Errorf("-decorate=%s cannot be used with -format=%s", opts.decorate, opts.format))
+	}
+	if stream && (len(opts.excludeFrom) > 0 || opts.sinceTag != "") {
+		check(fmt.Errorf("-exclude-reachable-from and -since-tag cannot be used with -format=%s", opts.format))
+	}
+	if opts.fsck && opts.pack != "" {
+		check(fmt.Errorf("-fsck cannot be used with -pack"))
+	}
+	if opts.watch && opts.output == "" {
+		check(fmt.Errorf("-watch requires -output"))
+	}
+	if opts.splitByRef {
+		switch {
+		case opts.output == "":
+			check(fmt.Errorf("-split-by-ref requires -output"))
+		case opts.watch:
+			check(fmt.Errorf("-split-by-ref cannot be used with -watch"))
+		case flag.NArg() > 0 || opts.head || opts.sinceTag != "":
+			check(fmt.Errorf("-split-by-ref cannot be used with arguments, -head or -since-tag"))
+		}
+	}
+	if opts.changed != "" {
+		switch {
+		case flag.NArg() > 0 || opts.all || opts.head || opts.sinceTag != "":
+			check(fmt.Errorf("-changed cannot be used with arguments, -all, -head or -since-tag"))
+		case opts.perArg || opts.splitByRef:
+			check(fmt.Errorf("-changed cannot be used with -per-arg or -split-by-ref"))
+		}
+	}
+	if opts.perArg {
+		switch {
+		case opts.outputDir == "":
+			check(fmt.Errorf("-per-arg requires -output-dir"))
+		case opts.output != "":
+			check(fmt.Errorf("-per-arg cannot be used with -output"))
+		case opts.watch:
+			check(fmt.Errorf("-per-arg cannot be used with -watch"))
+		case opts.splitByRef:
+			check(fmt.Errorf("-per-arg cannot be used with -split-by-ref"))
+		case flag.NArg() == 0 && !opts.head:
+			check(fmt.Errorf("-per-arg requires arguments or -head"))
+		}
+	} else if opts.outputDir != "" {
+		check(fmt.Errorf("-output-dir requires -per-arg"))
 	}
-	return walkObj(s, obj)
-}
 
-func walkObj(s storer.EncodedObjectStorer, obj plumbing.EncodedObject) error {
-	h := obj.Hash()
-	switch obj.Type() {
-	case plumbing.TagObject:
-		return walkTag(s, h)
-	case plumbing.CommitObject:
-		return walkCommit(s, h)
-	case plumbing.TreeObject:
-		return walkTree(s, h)
-	case plumbing.BlobObject:
-		blobs[h] = true
+	if opts.pack != "" {
+		// A pack has no references, so walk every object in it.
+		opts.dangling = true
 	}
-	return nil
-}
+	r, err := openRepository(opts)
+	check(err)
 
-func walkTag(s storer.EncodedObjectStorer, h plumbing.Hash) error {
-	if tags[h] {
-		return nil
+	opts.provenance = provenance(r, opts)
+
+	if !isFlagSet("abbrev") {
+		opts.abbrev = configAbbrev(r)
 	}
-	tags[h] = true
-	tag, err := object.GetTag(s, h)
-	if err != nil {
-		return fmt.Errorf("walkTag %s: %v", h, err)
+	if opts.abbrev < minAbbrev || opts.abbrev > len(plumbing.ZeroHash.String()) {
+		check(fmt.Errorf("-abbrev must be between %d and %d", minAbbrev, len(plumbing.ZeroHash.String())))
 	}
-	edges[h] = []plumbing.Hash{tag.Target}
-	return walk(s, tag.Target)
+
+	args := flag.Args()
+	if opts.head {
+		check(checkHead(r.Storer))
+		args = append(args, "HEAD")
+	}
+	if opts.sinceTag != "" {
+		name, err := resolveTag(r, opts.sinceTag)
+		check(err)
+		opts.excludeFrom = append(opts.excludeFrom, string(name))
+		if len(args) == 0 && !opts.all {
+			args = append(args, "HEAD")
+		}
+	}
+
+	if opts.splitByRef {
+		check(splitByRef(r, opts))
+		return
+	}
+	if opts.perArg {
+		check(splitByArg(r, args, opts))
+		return
+	}
+	if opts.watch {
+		check(watch(r, args, opts))
+		return
+	}
+	check(generate(r, args, opts))
 }
 
-func walkCommit(s storer.EncodedObjectStorer, h plumbing.Hash) error {
-	if commits[h] {
-		return nil
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `usage: git-graphviz [flags] [ref | hash]...
+
+Graph the objects reachable from each named reference or object. With no
+arguments, every reference is walked as if -all were given; unreachable
+objects are only included with -dangling or -everything.
+
+A -format that is not built in is rendered by the program
+git-graphviz-render-<format> on the PATH, if there is one. It reads the graph
+from its standard input as the document -format=json writes, and writes the
+output to its standard output.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// generate walks the repository from the given arguments and writes the
+// resulting graph to the -output file, or to stdout without one. The file is
+// written under a temporary name beside it and only renamed into place once
+// the graph has been rendered, so a failed walk leaves the last graph written,
+// as -watch relies on.
+func generate(r *git.Repository, args []string, opts *options) error {
+	if opts.output == "" {
+		return generateTo(os.Stdout, r, args, opts)
 	}
-	commits[h] = true
-	commit, err := object.GetCommit(s, h)
+	f, err := ioutil.TempFile(filepath.Dir(opts.output), "."+filepath.Base(opts.output)+".")
 	if err != nil {
-		return fmt.Errorf("walkCommit %s: %v", h, err)
+		return err
 	}
-	edges[h] = append(commit.ParentHashes[:], commit.TreeHash)
-	if err := walkTree(s, commit.TreeHash); err != nil {
+	err = generateTo(f, r, args, opts)
+	if _, ok := err.(corruptedError); err != nil && !ok {
+		f.Close()
+		os.Remove(f.Name())
 		return err
 	}
-	for _, p := range commit.ParentHashes {
-		if err := walkCommit(s, p); err != nil {
-			return err
-		}
+	// TempFile creates the file readable only by its owner.
+	if cerr := f.Chmod(0644); cerr != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return cerr
 	}
-	return nil
+	if cerr := f.Close(); cerr != nil {
+		os.Remove(f.Name())
+		return cerr
+	}
+	if rerr := os.Rename(f.Name(), opts.output); rerr != nil {
+		os.Remove(f.Name())
+		return rerr
+	}
+	return err
 }
 
-func walkTree(s storer.EncodedObjectStorer, h plumbing.Hash) error {
-	if trees[h] {
-		return nil
-	}
-	trees[h] = true
-	t, err := object.GetTree(s, h)
-	if err != nil {
-		return fmt.Errorf("walkTree %s: %v", h, err)
+func generateTo(w io.Writer, r *git.Repository, args []string, opts *options) error {
+	ctx := context.Background()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
 	}
-	for _, entry := range t.Entries {
-		if entry.Mode == filemode.Dir {
-			edges[h] = append(edges[h], entry.Hash)
-			if err := walkTree(s, entry.Hash); err != nil {
-				return err
+	g := newGraph(opts)
+	if newStream, ok := streamers[opts.format]; ok {
+		stream := newStream(w)
+		g.listener = stream
+		if err := g.populate(ctx, r, args, opts); err != nil {
+			return walkError(ctx, err, opts)
+		}
+		if opts.fsck {
+			if err := g.fsck(ctx, r); err != nil {
+				return walkError(ctx, err, opts)
 			}
 		}
-		if entry.Mode.IsFile() {
-			edges[h] = append(edges[h], entry.Hash)
-			blobs[entry.Hash] = true
+		if err := stream.close(); err != nil {
+			return err
 		}
-		if entry.Mode == filemode.Submodule {
-			edges[h] = append(edges[h], entry.Hash)
-			if err := walkCommit(s, entry.Hash); err != nil {
-				return err
-			}
+		if opts.stats != "" {
+			return writeStats(os.Stderr, g, opts)
 		}
+		return nil
 	}
-	return nil
-}
-
-func render(opts *options) {
-	fmt.Println("digraph {")
-	nodeAttrs := map[string]string{"fontname": "AnonymousPro"}
-	if !opts.noColor {
-		nodeAttrs["style"] = "filled"
+	if err := g.populate(ctx, r, args, opts); err != nil {
+		return walkError(ctx, err, opts)
 	}
-	fmt.Printf("\tnode %s;\n", renderAttrs(nodeAttrs))
-	for h := range tags {
-		attrs := map[string]string{
-			"label": label(h, "tag", opts.noTypes),
-		}
-		if !opts.noColor {
-			attrs["color"] = "lightskyblue"
+	if opts.fsck {
+		if err := g.fsck(ctx, r); err != nil {
+			return walkError(ctx, err, opts)
 		}
-		fmt.Printf("\t\"%s\" %s;\n", h, renderAttrs(attrs))
 	}
-	for h := range commits {
-		attrs := map[string]string{
-			"group": "commits",
-			"label": label(h, "commit", opts.noTypes),
-		}
-		if !opts.noColor {
-			attrs["color"] = "yellowgreen"
+	if opts.mergeBase {
+		if err := g.limitToMergeBase(r, args); err != nil {
+			return err
 		}
-		fmt.Printf("\t\"%s\" %s;\n", h, renderAttrs(attrs))
 	}
-	for h := range trees {
-		attrs := map[string]string{
-			"label": label(h, "tree", opts.noTypes),
+	if opts.followRenames {
+		if err := g.annotateRenames(ctx, r.Storer); err != nil {
+			return walkError(ctx, err, opts)
 		}
-		if !opts.noColor {
-			attrs["color"] = "tomato"
+	}
+	g.filter(opts)
+	if opts.packIndex != nil {
+		if err := g.recordPacked(opts.packIndex); err != nil {
+			return err
 		}
-		fmt.Printf("\t\"%s\" %s;\n", h, renderAttrs(attrs))
 	}
-	for h := range blobs {
-		attrs := map[string]string{
-			"label": label(h, "blob", opts.noTypes),
+	if opts.stats != "" {
+		if err := writeStats(os.Stderr, g, opts); err != nil {
+			return err
 		}
-		if !opts.noColor {
-			attrs["color"] = "gold"
+	}
+	if opts.anonymize {
+		if err := g.anonymize(); err != nil {
+			return err
 		}
-		fmt.Printf("\t\"%s\" %s;\n", h, renderAttrs(attrs))
 	}
-	if !opts.noRefs {
-		for name, ref := range refs {
-			attrs := map[string]string{"shape": "box"}
-			if !opts.noColor {
-				attrs["color"] = "plum"
-			}
-			fmt.Printf("\t\"%s\" %s;\n", name, renderAttrs(attrs))
-			var target fmt.Stringer = ref.Hash()
-			if ref.Type() == plumbing.SymbolicReference {
-				target = ref.Target()
-				if _, ok := refs[target.String()]; !ok {
-					continue
-				}
-			}
-			fmt.Printf("\t\"%s\" -> \"%s\";\n", name, target)
+	if err := renderers[opts.format](w, g, opts); err != nil {
+		return err
+	}
+	if g.corrupted > 0 {
+		return corruptedError(g.corrupted)
+	}
+	return nil
+}
+
+// walkError explains an error that ended the walk early, which may have been
+// caused by -timeout.
+func walkError(ctx context.Context, err error, opts *options) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("walk timed out after %s", opts.timeout)
+	}
+	return err
+}
+
+// openRepository opens the repository to graph, or the -pack packfile, along
+// with the object directories of -alternate and, for a repository, those named
+// by GIT_ALTERNATE_OBJECT_DIRECTORIES.
+func openRepository(opts *options) (*git.Repository, error) {
+	var r *git.Repository
+	var err error
+	alternates := append([]string(nil), opts.alternates...)
+	if opts.pack != "" {
+		r, err = openPack(opts.pack)
+	} else {
+		r, err = repo()
+		if dirs := os.Getenv("GIT_ALTERNATE_OBJECT_DIRECTORIES"); dirs != "" {
+			alternates = append(alternates, filepath.SplitList(dirs)...)
 		}
 	}
-	for h, targets := range edges {
-		for _, target := range targets {
-			fmt.Printf("\t\"%s\" -> \"%s\";\n", h, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(alternates) > 0 {
+		if r.Storer, err = withAlternates(r.Storer, alternates); err != nil {
+			return nil, err
 		}
 	}
-	fmt.Println("}")
+	return r, nil
 }
 
-func renderAttrs(attrs map[string]string) string {
-	var as []string
-	for k, v := range attrs {
-		as = append(as, fmt.Sprintf("%s=\"%s\"", k, v))
+// repo opens the repository git would use in the current directory, honoring
+// the environment variables that relocate its parts.
+func repo() (*git.Repository, error) {
+	r, err := openRepo()
+	if err != nil {
+		return nil, err
+	}
+	if r, err = withCommonDir(r); err != nil {
+		return nil, err
+	}
+	return withObjectDir(r)
+}
+
+func openRepo() (*git.Repository, error) {
+	if gitdir, ok := os.LookupEnv("GIT_DIR"); ok {
+		dotgit, err := filesystem.NewStorage(osfs.New(gitdir))
+		if err != nil {
+			return nil, err
+		}
+		return git.Open(dotgit, osfs.New(os.Getenv("GIT_WORK_TREE")))
 	}
-	return fmt.Sprintf("[%s]", strings.Join(as, ","))
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return git.PlainOpen(dir)
+}
+
+// hasURLs reports whether any object nodes are linked to a URL.
+func hasURLs(opts *options) bool {
+	return opts.urlTemplate != "" || opts.urlCommit != "" || opts.urlTree != "" || opts.urlBlob != ""
+}
+
+// isFlagSet reports whether the named flag was passed on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func label(h plumbing.Hash, t string, noTypes bool) string {
-	if noTypes {
-		return abbrev(h)
+// configAbbrev returns the abbreviation length configured by core.abbrev in
+// the repository config, falling back to defaultAbbrev when it is unset,
+// "auto" or otherwise unusable.
+func configAbbrev(r *git.Repository) int {
+	cfg, err := r.Config()
+	if err != nil {
+		return defaultAbbrev
+	}
+	v := cfg.Raw.Section("core").Option("abbrev")
+	switch v {
+	case "", "auto":
+		return defaultAbbrev
+	case "no", "false", "off":
+		return len(plumbing.ZeroHash.String())
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return defaultAbbrev
+	}
+	// Like git, clamp the configured value into the usable range.
+	if n < minAbbrev {
+		return minAbbrev
 	}
-	return t + "\\n" + abbrev(h)
+	if n > len(plumbing.ZeroHash.String()) {
+		return len(plumbing.ZeroHash.String())
+	}
+	return n
 }
 
-func abbrev(h plumbing.Hash) string {
-	return h.String()[:6]
+func check(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "git-graphviz: Error: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+// fixture is a repository built by running git in a temporary directory.
+// Each commit it makes is dated a minute after the last, so the hashes of the
+// objects in it are the same on every run.
+type fixture struct {
+	t    testing.TB
+	dir  string
+	tick int
+}
+
+// newFixture creates an empty repository whose HEAD is refs/heads/main, or
+// skips the test if git is not installed.
+func newFixture(t testing.TB, initArgs ...string) *fixture {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	f := &fixture{t: t, dir: t.TempDir()}
+	f.git(append([]string{"init", "-q"}, initArgs...)...)
+	f.git("symbolic-ref", "HEAD", "refs/heads/main")
+	return f
+}
+
+// git runs git in the fixture and returns its output, without the trailing
+// newline.
+func (f *fixture) git(args ...string) string {
+	f.t.Helper()
+	return f.gitInput("", args...)
+}
+
+// gitInput runs git in the fixture with input as its standard input.
+func (f *fixture) gitInput(input string, args ...string) string {
+	f.t.Helper()
+	date := fmt.Sprintf("%d +0000", 1500000000+60*f.tick)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = f.dir
+	cmd.Env = append(os.Environ(),
+		"HOME="+f.dir,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=A U Thor",
+		"GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_AUTHOR_DATE="+date,
+		"GIT_COMMITTER_NAME=C O Mitter",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+		"GIT_COMMITTER_DATE="+date,
+	)
+	cmd.Stdin = strings.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		f.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, stderr.Bytes())
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// write writes a file in the work tree, creating the directories it is in,
+// and stages it.
+func (f *fixture) write(name, content string) {
+	f.t.Helper()
+	p := filepath.Join(f.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+	f.git("add", name)
+}
+
+// commit commits what is staged, or nothing, and returns the new commit's
+// hash.
+func (f *fixture) commit(msg string) string {
+	f.t.Helper()
+	f.tick++
+	f.git("commit", "-q", "--allow-empty", "-m", msg)
+	return f.git("rev-parse", "HEAD")
+}
+
+// commitTree creates a commit of the tree of HEAD with the given parents,
+// without moving any branch, and returns its hash.
+func (f *fixture) commitTree(msg string, parents ...string) string {
+	f.t.Helper()
+	f.tick++
+	args := []string{"commit-tree", "-m", msg}
+	for _, p := range parents {
+		args = append(args, "-p", p)
+	}
+	return f.git(append(args, "HEAD^{tree}")...)
+}
+
+// testOptions returns the options git-graphviz runs with when no flags are
+// given, except that the output is deterministic.
+func testOptions() *options {
+	return &options{
+		format:          "dot",
+		abbrev:          defaultAbbrev,
+		decorate:        "boxes",
+		sortCommitsBy:   "hash",
+		highlightRadius: -1,
+		deterministic:   true,
+	}
+}
+
+// render graphs the fixture from args with opts, failing the test if that
+// fails.
+func (f *fixture) render(opts *options, args ...string) string {
+	f.t.Helper()
+	out, err := f.tryRender(opts, args...)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return out
+}
+
+// tryRender graphs the fixture from args with opts.
+func (f *fixture) tryRender(opts *options, args ...string) (string, error) {
+	f.t.Helper()
+	r, err := git.PlainOpen(f.dir)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = generateTo(&buf, r, args, opts)
+	return buf.String(), err
+}
+
+// TestPackedRefs checks that references held only in the packed-refs file of
+// a bare mirror are all drawn and walked, and can be named as arguments.
+func TestPackedRefs(t *testing.T) {
+	src := newFixture(t)
+	first := src.commit("first")
+	src.git("tag", "-a", "-m", "v1", "v1", first)
+	second := src.commit("second")
+	src.git("branch", "topic", first)
+
+	f := &fixture{t: t, dir: filepath.Join(t.TempDir(), "mirror.git")}
+	src.git("clone", "-q", "--mirror", src.dir, f.dir)
+	f.git("pack-refs", "--all")
+	loose := f.git("for-each-ref", "--format=%(refname)")
+	for _, name := range strings.Fields(loose) {
+		if _, err := os.Stat(filepath.Join(f.dir, filepath.FromSlash(name))); err == nil {
+			t.Fatalf("%s is a loose reference", name)
+		}
+	}
+
+	out := f.render(testOptions())
+	for _, want := range []string{"refs/heads/main", "refs/heads/topic", "refs/tags/v1", first, second} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%s is missing:\n%s", want, out)
+		}
+	}
+
+	out = f.render(testOptions(), "refs/tags/v1")
+	if !strings.Contains(out, first) || strings.Contains(out, second) {
+		t.Errorf("graph of refs/tags/v1 should hold %s but not %s:\n%s", first, second, out)
+	}
+}
+
+// TestInteractiveSVG checks that the options -interactive-svg sets give each
+// object node its full hash as a tooltip and a link, in DOT and, when
+// Graphviz is installed, in the SVG rendered from it.
+func TestInteractiveSVG(t *testing.T) {
+	f := newFixture(t)
+	f.write("file", "content\n")
+	c := f.commit("first")
+	blob := f.git("rev-parse", c+":file")
+
+	tests := []struct {
+		format string
+		want   func(h string) []string
+	}{
+		{"dot", func(h string) []string {
+			return []string{`URL="https://example.com/` + h + `"`, `tooltip="` + h + `"`}
+		}},
+		{"svg", func(h string) []string {
+			return []string{`xlink:href="https://example.com/` + h + `"`, `xlink:title="` + h + `"`}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if tt.format != "dot" {
+				if _, err := exec.LookPath("dot"); err != nil {
+					t.Skip("Graphviz is not installed")
+				}
+			}
+			opts := testOptions()
+			opts.format = tt.format
+			opts.tooltips = true
+			opts.urlTemplate = "https://example.com/{hash}"
+			out := f.render(opts)
+			for _, h := range []string{c, blob} {
+				for _, want := range tt.want(h) {
+					if !strings.Contains(out, want) {
+						t.Errorf("%s is missing:\n%s", want, out)
+					}
+				}
+			}
+		})
+	}
+}
+
+// renderEnv graphs the repository git would use in the current directory and
+// environment, as git-graphviz run there would.
+func renderEnv(t *testing.T, opts *options, args ...string) string {
+	t.Helper()
+	r, err := openRepository(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := generateTo(&buf, r, args, opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestLinkedWorktree(t *testing.T) {
+	f := newFixture(t)
+	first := f.commit("first")
+	wt := filepath.Join(t.TempDir(), "wt")
+	f.git("worktree", "add", "-q", "-b", "topic", wt)
+	f.git("-C", wt, "commit", "-q", "--allow-empty", "-m", "second")
+	second := f.git("rev-parse", "topic")
+
+	// A git directory holding only its HEAD, whose references and objects
+	// are all in the common directory.
+	bare := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bare, "HEAD"), []byte("ref: refs/heads/topic\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		env  map[string]string
+	}{
+		{"commondir file", wt, nil},
+		{"GIT_COMMON_DIR", f.dir, map[string]string{
+			"GIT_DIR":        bare,
+			"GIT_COMMON_DIR": filepath.Join(f.dir, ".git"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(tt.dir)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			out := renderEnv(t, testOptions())
+			for _, want := range []string{
+				"\t" + dotID("HEAD") + " -> " + dotID("refs/heads/topic") + ";",
+				dotID("refs/heads/main"),
+				first,
+				second,
+			} {
+				if !strings.Contains(out, want) {
+					t.Errorf("%s is missing:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestObjectDirectoryEnv(t *testing.T) {
+	tests := []string{"GIT_OBJECT_DIRECTORY", "GIT_ALTERNATE_OBJECT_DIRECTORIES"}
+	for _, env := range tests {
+		t.Run(env, func(t *testing.T) {
+			f := newFixture(t)
+			f.write("file", "content\n")
+			c := f.commit("first")
+			blob := f.git("rev-parse", c+":file")
+
+			// Move every object out of the repository, leaving its
+			// objects directory empty.
+			objects := filepath.Join(f.dir, ".git", "objects")
+			moved := filepath.Join(t.TempDir(), "objects")
+			if err := os.Rename(objects, moved); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Join(objects, "pack"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(f.dir)
+			t.Setenv(env, moved)
+
+			opts := testOptions()
+			opts.alternates = stringList{}
+			out := renderEnv(t, opts)
+			for _, h := range []string{c, blob} {
+				if !strings.Contains(out, h) {
+					t.Errorf("%s is missing:\n%s", h, out)
+				}
+			}
+			if len(opts.alternates) != 0 {
+				t.Errorf("opts.alternates = %v, want it left empty", opts.alternates)
+			}
+		})
+	}
+}
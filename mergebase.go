@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// limitToMergeBase computes the merge bases of the two commits named by args
+// and removes every commit that is not reachable from one of them or is below
+// all of the merge bases, leaving the two lines of history that meet at them
+// and the tags and references into them. Criss-cross merges can have several
+// merge bases, which are all kept.
+func (g *graph) limitToMergeBase(r *git.Repository, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("-merge-base requires exactly two arguments, got %d", len(args))
+	}
+	var tips []plumbing.Hash
+	for _, n := range args {
+		h, err := g.commitFor(r, n)
+		if err != nil {
+			return fmt.Errorf("-merge-base: %v", err)
+		}
+		tips = append(tips, h)
+	}
+	a, b := g.ancestors(tips[0]), g.ancestors(tips[1])
+	var common []plumbing.Hash
+	for h := range a {
+		if b[h] {
+			common = append(common, h)
+		}
+	}
+	if len(common) == 0 {
+		return fmt.Errorf("-merge-base: %s and %s have no common ancestor", args[0], args[1])
+	}
+
+	// The merge bases are the common ancestors that are not themselves
+	// ancestors of another common ancestor.
+	var starts []plumbing.Hash
+	for _, h := range common {
+		starts = append(starts, g.parents(h)...)
+	}
+	below := g.ancestors(starts...)
+	for _, h := range common {
+		if !below[h] {
+			infof("merge base %s", h)
+			g.mergeBases[h] = true
+		}
+	}
+
+	pruned := make(map[plumbing.Hash]bool)
+	for _, h := range g.hashes(commitType) {
+		if (a[h] || b[h]) && !below[h] {
+			continue
+		}
+		infof("prune %s: not between the tips and their merge base", h)
+		pruned[h] = true
+		delete(g.nodes, h)
+		delete(g.edges, h)
+	}
+	g.dropRefsInto(pruned)
+	for h, es := range g.edges {
+		var kept []edge
+		for _, e := range es {
+			if !pruned[e.target] {
+				kept = append(kept, e)
+			}
+		}
+		g.edges[h] = kept
+	}
+	return nil
+}
+
+// commitFor returns the commit in the graph named by the reference or hash n,
+// peeling any tags along the way.
+func (g *graph) commitFor(r *git.Repository, n string) (plumbing.Hash, error) {
+	var h plumbing.Hash
+	if ref, err := r.Reference(plumbing.ReferenceName(n), true); err == nil {
+		h = ref.Hash()
+	} else if h, err = resolveHash(r.Storer, n); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	h = g.peel(h)
+	if !g.is(h, commitType) {
+		return plumbing.ZeroHash, fmt.Errorf("%s is not a commit", n)
+	}
+	return h, nil
+}
+
+// ancestors returns the commits in the graph reachable from any of hs,
+// including hs themselves.
+func (g *graph) ancestors(hs ...plumbing.Hash) map[plumbing.Hash]bool {
+	seen := make(map[plumbing.Hash]bool)
+	queue := append([]plumbing.Hash(nil), hs...)
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if seen[h] || !g.is(h, commitType) {
+			continue
+		}
+		seen[h] = true
+		queue = append(queue, g.parents(h)...)
+	}
+	return seen
+}
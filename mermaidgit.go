@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// renderMermaidGit writes the commits of the graph as a Mermaid gitGraph
+// diagram, oldest first, with each commit on the branch whose first-parent
+// history it is on. Tags, trees and blobs are left out, though tags label the
+// commits they point at.
+//
+// A gitGraph can only commit, branch and merge at the tip of a branch, and
+// merges have two parents, so octopus merges, branches started from an older
+// commit, merges of a commit that is no longer its branch's tip and unrelated
+// histories cannot be drawn as they are. Such commits are drawn as near as the
+// diagram allows and a warning says how many there were.
+func renderMermaidGit(out io.Writer, g *graph, opts *options) error {
+	lanes := g.mermaidLanes()
+	tags := make(map[plumbing.Hash][]string)
+	for _, name := range sortedRefNames(g.refs) {
+		if ref := g.refs[name]; strings.HasPrefix(name, "refs/tags/") && ref.Type() == plumbing.HashReference {
+			h := g.peel(ref.Hash())
+			tags[h] = append(tags[h], strings.TrimPrefix(name, "refs/tags/"))
+		}
+	}
+	newest := g.newestFirst()
+	var order []plumbing.Hash
+	for i := len(newest) - 1; i >= 0; i-- {
+		order = append(order, newest[i])
+	}
+	// Each branch is started as soon as the commit it forks from is drawn,
+	// while that commit is still the tip of its own branch.
+	forks := make(map[plumbing.Hash][]string)
+	started := make(map[string]bool)
+	for _, c := range order {
+		lane := lanes[c]
+		if started[lane] {
+			continue
+		}
+		started[lane] = true
+		if ps := g.parents(c); len(ps) > 0 {
+			forks[ps[0]] = append(forks[ps[0]], lane)
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	if len(order) == 0 {
+		fmt.Fprintln(w, "gitGraph")
+		return w.Flush()
+	}
+	current := lanes[order[0]]
+	fmt.Fprintf(w, "%%%%{init: {'gitGraph': {'mainBranchName': '%s'}}}%%%%\ngitGraph\n", current)
+	tips := map[string]plumbing.Hash{current: order[0]}
+	unfaithful := 0
+	unfaithfulf := func(format string, args ...interface{}) {
+		unfaithful++
+		infof("-format=mermaid-git: "+format, args...)
+	}
+	for _, c := range order {
+		lane := lanes[c]
+		parents := g.parents(c)
+		if _, ok := tips[lane]; !ok {
+			// Branches are started where they fork, so this is the
+			// root of an unrelated history.
+			unfaithfulf("commit %s has no parents, but is drawn branching off %s", abbrev(c, opts.abbrev), current)
+			fmt.Fprintf(w, "\tbranch %s\n", lane)
+			tips[lane] = tips[current]
+		} else if lane != current {
+			fmt.Fprintf(w, "\tcheckout %s\n", lane)
+		}
+		current = lane
+		if len(parents) > 0 && tips[lane] != parents[0] {
+			unfaithfulf("commit %s is drawn after %s rather than its first parent %s", abbrev(c, opts.abbrev), abbrev(tips[lane], opts.abbrev), abbrev(parents[0], opts.abbrev))
+		}
+		attrs := fmt.Sprintf(" id: %s", mermaidString(abbrev(c, opts.abbrev)))
+		if ts := tags[c]; len(ts) > 0 {
+			attrs += fmt.Sprintf(" tag: %s", mermaidString(strings.Join(ts, ", ")))
+		}
+		switch {
+		case len(parents) < 2:
+			fmt.Fprintf(w, "\tcommit%s\n", attrs)
+		case lanes[parents[1]] == lane:
+			unfaithfulf("merge %s joins two commits of the same branch, and is drawn as a commit", abbrev(c, opts.abbrev))
+			fmt.Fprintf(w, "\tcommit%s\n", attrs)
+		default:
+			if len(parents) > 2 {
+				unfaithfulf("octopus merge %s is drawn merging only its second parent", abbrev(c, opts.abbrev))
+			}
+			from := lanes[parents[1]]
+			if tips[from] != parents[1] {
+				unfaithfulf("merge %s is drawn merging %s rather than its parent %s", abbrev(c, opts.abbrev), abbrev(tips[from], opts.abbrev), abbrev(parents[1], opts.abbrev))
+			}
+			fmt.Fprintf(w, "\tmerge %s%s\n", from, attrs)
+		}
+		tips[lane] = c
+		for _, f := range forks[c] {
+			if f != lane {
+				fmt.Fprintf(w, "\tbranch %s\n", f)
+				tips[f] = c
+				current = f
+			}
+		}
+	}
+	if unfaithful > 0 {
+		warnf("-format=mermaid-git: could not draw %d of %d commits faithfully; use -verbose to list them", unfaithful, len(order))
+	}
+	return w.Flush()
+}
+
+// mermaidLanes assigns every commit in the graph to a gitGraph branch: each
+// branch reference claims the first-parent history of its tip not already
+// claimed, the branch HEAD points at first and the rest in name order.
+// Commits left over, which are only reachable through merges or other
+// references, are given branches named after the newest commit of each
+// first-parent history.
+func (g *graph) mermaidLanes() map[plumbing.Hash]string {
+	var tips []string
+	if head, ok := g.refs["HEAD"]; ok && head.Type() == plumbing.SymbolicReference {
+		if _, ok := g.refs[head.Target().String()]; ok && strings.HasPrefix(head.Target().String(), "refs/heads/") {
+			tips = append(tips, head.Target().String())
+		}
+	}
+	for _, name := range sortedRefNames(g.refs) {
+		if strings.HasPrefix(name, "refs/heads/") && (len(tips) == 0 || name != tips[0]) {
+			tips = append(tips, name)
+		}
+	}
+	lanes := make(map[plumbing.Hash]string)
+	used := make(map[string]bool)
+	claim := func(h plumbing.Hash, name string) {
+		lane := mermaidBranch(name)
+		for used[lane] {
+			lane += "_"
+		}
+		used[lane] = true
+		for g.is(h, commitType) {
+			if _, ok := lanes[h]; ok {
+				break
+			}
+			lanes[h] = lane
+			ps := g.parents(h)
+			if len(ps) == 0 {
+				break
+			}
+			h = ps[0]
+		}
+	}
+	for _, name := range tips {
+		if ref := g.refs[name]; ref.Type() == plumbing.HashReference {
+			if _, ok := lanes[ref.Hash()]; !ok && g.is(ref.Hash(), commitType) {
+				claim(ref.Hash(), shortRefName(name))
+			}
+		}
+	}
+	for _, h := range g.newestFirst() {
+		if _, ok := lanes[h]; !ok {
+			claim(h, "branch-"+abbrev(h, minAbbrev))
+		}
+	}
+	return lanes
+}
+
+// mermaidUnsafe matches the characters that cannot appear in a gitGraph
+// branch name.
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_./-]+`)
+
+// mermaidBranch returns the reference short name as a gitGraph branch name.
+func mermaidBranch(name string) string {
+	return mermaidUnsafe.ReplaceAllString(name, "-")
+}
+
+// mermaidString returns s as a double-quoted gitGraph string. There is no
+// escape for a double quote, so they are replaced by single ones.
+func mermaidString(s string) string {
+	return `"` + strings.Replace(s, `"`, "'", -1) + `"`
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ndjsonEvent is a single line of -format=ndjson output, describing either a
+// node or an edge.
+type ndjsonEvent struct {
+	Kind  string `json:"kind"`
+	Type  string `json:"type,omitempty"`
+	Hash  string `json:"hash,omitempty"`
+	Name  string `json:"name,omitempty"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+	Role  string `json:"role,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// ndjsonStream writes one JSON object per line for each node and edge as it
+// is discovered. References are identified by name, objects by hash.
+type ndjsonStream struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+	err error
+}
+
+func newNDJSONStream(w io.Writer) stream {
+	bw := bufio.NewWriter(w)
+	return &ndjsonStream{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (n *ndjsonStream) node(typ, id string) {
+	ev := ndjsonEvent{Kind: "node", Type: typ, Hash: id}
+	if typ == "ref" {
+		ev.Hash, ev.Name = "", id
+	}
+	n.write(ev)
+}
+
+func (n *ndjsonStream) edge(from, to, role, label string) {
+	n.write(ndjsonEvent{Kind: "edge", From: from, To: to, Role: role, Label: label})
+}
+
+func (n *ndjsonStream) write(ev ndjsonEvent) {
+	if n.err != nil {
+		return
+	}
+	n.err = n.enc.Encode(ev)
+}
+
+func (n *ndjsonStream) close() error {
+	if n.err != nil {
+		return n.err
+	}
+	return n.w.Flush()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/src-d/go-billy.v4/helper/mount"
+	"gopkg.in/src-d/go-billy.v4/helper/polyfill"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// objectDirStorer is a storage.Storer whose objects are read from the
+// directory named by GIT_OBJECT_DIRECTORY instead of the objects directory
+// of the repository. Everything else comes from the repository.
+type objectDirStorer struct {
+	storage.Storer
+	dir     string
+	objects *filesystem.Storage
+}
+
+// withObjectDir returns r reading its objects from GIT_OBJECT_DIRECTORY when
+// it is set, or r unchanged when it is not.
+func withObjectDir(r *git.Repository) (*git.Repository, error) {
+	dir := os.Getenv("GIT_OBJECT_DIRECTORY")
+	if dir == "" {
+		return r, nil
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("GIT_OBJECT_DIRECTORY: %v", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("GIT_OBJECT_DIRECTORY: %s is not a directory", dir)
+	}
+	s, err := objectStorage(dir)
+	if err != nil {
+		return nil, fmt.Errorf("GIT_OBJECT_DIRECTORY: %v", err)
+	}
+	r.Storer = &objectDirStorer{Storer: r.Storer, dir: dir, objects: s}
+	return r, nil
+}
+
+// objectStorage returns a storage whose objects are those of the object
+// directory dir. go-git reads objects from the objects directory of a git
+// directory, so dir is mounted there in an otherwise empty one, whatever it is
+// called.
+func objectStorage(dir string) (*filesystem.Storage, error) {
+	return filesystem.NewStorage(polyfill.New(mount.New(memfs.New(), "objects", osfs.New(dir))))
+}
+
+func (o *objectDirStorer) NewEncodedObject() plumbing.EncodedObject {
+	return o.objects.NewEncodedObject()
+}
+
+func (o *objectDirStorer) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	return o.objects.SetEncodedObject(obj)
+}
+
+func (o *objectDirStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	return o.objects.EncodedObject(t, h)
+}
+
+func (o *objectDirStorer) HasEncodedObject(h plumbing.Hash) error {
+	return o.objects.HasEncodedObject(h)
+}
+
+func (o *objectDirStorer) IterEncodedObjects(t plumbing.ObjectType) (storer.EncodedObjectIter, error) {
+	return o.objects.IterEncodedObjects(t)
+}
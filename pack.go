@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// packStorer is a storage.Storer whose objects are read from a single
+// packfile. References and configuration are held in memory, and start out
+// empty.
+type packStorer struct {
+	storage.Storer
+	pack *packfile.Packfile
+}
+
+// openPack returns a repository with no references whose objects are those of
+// the packfile at path, located through the .idx file beside it.
+func openPack(path string) (*git.Repository, error) {
+	fs := osfs.New(filepath.Dir(path))
+	name := filepath.Base(path)
+	idx, err := readPackIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	pf, err := fs.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("pack %s: %v", path, err)
+	}
+
+	// Initializing the repository points HEAD at an unborn branch, which
+	// would otherwise show up as a dangling reference.
+	mem := memory.NewStorage()
+	r, err := git.Init(mem, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := mem.RemoveReference(plumbing.HEAD); err != nil {
+		return nil, err
+	}
+	r.Storer = &packStorer{
+		Storer: mem,
+		pack:   packfile.NewPackfile(idx, nil, pf),
+	}
+	return r, nil
+}
+
+// readPackIndex reads the .idx file of the packfile at path, which may name
+// either the pack or its index.
+func readPackIndex(path string) (*idxfile.MemoryIndex, error) {
+	name := path
+	if strings.HasSuffix(path, ".pack") {
+		name = strings.TrimSuffix(path, ".pack") + ".idx"
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("pack %s: %v", path, err)
+	}
+	defer f.Close()
+	idx := idxfile.NewMemoryIndex()
+	if err := idxfile.NewDecoder(f).Decode(idx); err != nil {
+		return nil, fmt.Errorf("pack %s: index: %v", path, err)
+	}
+	return idx, nil
+}
+
+// recordPacked records which objects in the graph are in the packfile
+// indexed by idx, for -only-objects-in-pack.
+func (g *graph) recordPacked(idx *idxfile.MemoryIndex) error {
+	for h := range g.nodes {
+		ok, err := idx.Contains(h)
+		if err != nil {
+			return err
+		}
+		if ok {
+			g.packed[h] = true
+		}
+	}
+	return nil
+}
+
+func (p *packStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := p.pack.Get(h)
+	if err != nil {
+		return nil, err
+	}
+	if t != plumbing.AnyObject && obj.Type() != t {
+		return nil, plumbing.ErrObjectNotFound
+	}
+	return obj, nil
+}
+
+func (p *packStorer) HasEncodedObject(h plumbing.Hash) error {
+	_, err := p.pack.FindOffset(h)
+	return err
+}
+
+func (p *packStorer) IterEncodedObjects(t plumbing.ObjectType) (storer.EncodedObjectIter, error) {
+	return p.pack.GetByType(t)
+}
+
+// absent reports whether, when graphing a single packfile or with -fsck, the
+// object h is not in the pack or repository. It is then added to the graph
+// as a missing placeholder so that edges into it still show where the pack
+// ends, or what is missing.
+func (g *graph) absent(s storer.EncodedObjectStorer, h plumbing.Hash) bool {
+	if (g.opts.pack == "" && !g.opts.fsck) || s.HasEncodedObject(h) == nil {
+		return false
+	}
+	if !g.mark(missingType, h) {
+		if g.opts.pack != "" {
+			infof("missing %s: not in pack", h)
+		} else {
+			infof("missing %s: not in the repository", h)
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"math"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+const (
+	minPenwidth = 1
+	maxPenwidth = 8
+)
+
+// scaledPenwidth returns the border width of a node with -scale-penwidth
+// whose magnitude is n: 1 + log2(1+n)/2, clamped to between minPenwidth and
+// maxPenwidth. n is the size in KiB of a blob or the number of files a
+// commit changes, so a 1 MiB blob or a commit touching a thousand files is
+// drawn about 6 points wide. The logarithm keeps the occasional huge object
+// from dwarfing the rest.
+func scaledPenwidth(n float64) float64 {
+	w := 1 + math.Log2(1+n)/2
+	return math.Max(minPenwidth, math.Min(maxPenwidth, w))
+}
+
+// changedFiles returns the number of files that commit changes from its
+// first parent, or that it adds if it has none. ok is false when the first
+// parent is not in the repository to compare against.
+func changedFiles(ctx context.Context, s storer.EncodedObjectStorer, commit *object.Commit) (n int, ok bool, err error) {
+	var from plumbing.Hash
+	if len(commit.ParentHashes) > 0 {
+		p := commit.ParentHashes[0]
+		if s.HasEncodedObject(p) == plumbing.ErrObjectNotFound {
+			return 0, false, nil
+		}
+		parent, err := object.GetCommit(s, p)
+		if err != nil {
+			return 0, false, err
+		}
+		from = parent.TreeHash
+	}
+	n, err = diffCount(ctx, s, from, commit.TreeHash)
+	return n, err == nil, err
+}
+
+// diffCount returns the number of files added, removed or modified between
+// the trees a and b, either of which may be the zero hash for an empty tree.
+func diffCount(ctx context.Context, s storer.EncodedObjectStorer, a, b plumbing.Hash) (int, error) {
+	n := 0
+	err := diffFiles(ctx, s, a, b, "", func(fileChange) { n++ })
+	return n, err
+}
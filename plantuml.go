@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// renderPlantUML writes the graph as a PlantUML diagram, with objects and
+// references as rectangles and edges as arrows between them.
+func renderPlantUML(out io.Writer, g *graph, opts *options) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "@startuml")
+	if l := graphLabel(g, opts); l != "" {
+		fmt.Fprintf(w, "title %s\n", l)
+	}
+	for _, set := range g.objectSets() {
+		for _, h := range set.hashes {
+			fmt.Fprintf(w, "rectangle \"%s\" as %s%s\n", plantUMLString(g.decoratedLabel(h, set.typ.String(), opts)), plantUMLAlias(h.String()), plantUMLColor(set.typ.String(), opts))
+		}
+	}
+	names := sortedRefNames(g.refs)
+	aliases := make(map[string]string, len(names))
+	for i, name := range names {
+		aliases[name] = fmt.Sprintf("ref%d", i)
+	}
+	for _, name := range names {
+		fmt.Fprintf(w, "rectangle \"%s\" as %s%s\n", plantUMLString(name), aliases[name], plantUMLColor("ref", opts))
+	}
+	for _, name := range names {
+		target, ok := g.refTarget(name)
+		if !ok {
+			continue
+		}
+		if a, ok := aliases[target]; ok {
+			fmt.Fprintf(w, "%s --> %s\n", aliases[name], a)
+		} else {
+			fmt.Fprintf(w, "%s --> %s\n", aliases[name], plantUMLAlias(target))
+		}
+	}
+	for _, h := range sortedEdgeSources(g.edges) {
+		for _, e := range g.edges[h] {
+			fmt.Fprintf(w, "%s --> %s", plantUMLAlias(h.String()), plantUMLAlias(e.target.String()))
+			if e.label != "" {
+				fmt.Fprintf(w, " : %s", plantUMLString(escapeLabel(e.label)))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintln(w, "@enduml")
+	return w.Flush()
+}
+
+// plantUMLAlias returns the PlantUML identifier of the object with the given
+// hex hash. Identifiers may not start with a digit.
+func plantUMLAlias(hash string) string {
+	return "o" + hash
+}
+
+func plantUMLColor(typ string, opts *options) string {
+	if opts.noColor {
+		return ""
+	}
+	return " #" + palette[typ]
+}
+
+// plantUMLString makes s safe to place inside a double-quoted PlantUML
+// string, which has no way of escaping a double quote.
+func plantUMLString(s string) string {
+	return strings.Replace(s, `"`, `'`, -1)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// pluginPrefix names the external renderer for a -format that is not built
+// in: git-graphviz-render-<format>, looked up on the PATH.
+const pluginPrefix = "git-graphviz-render-"
+
+// findPlugin returns the path of the external renderer for format, or false
+// if there is none.
+func findPlugin(format string) (string, bool) {
+	if format == "" || strings.ContainsAny(format, `/\`+string(filepath.ListSeparator)) {
+		return "", false
+	}
+	path, err := exec.LookPath(pluginPrefix + format)
+	return path, err == nil
+}
+
+// external returns a renderer that runs the external renderer at path. It is
+// given the graph on its standard input as the document -format=json writes,
+// schemaVersion included, and no arguments. Whatever it writes to standard
+// output is the output, its standard error is passed through, and a nonzero
+// exit status fails the run.
+func external(path string) renderer {
+	return func(w io.Writer, g *graph, opts *options) error {
+		var in bytes.Buffer
+		if err := renderJSON(&in, g, opts); err != nil {
+			return err
+		}
+		cmd := exec.Command(path)
+		cmd.Stdin = &in
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("-format=%s: %s: %v", opts.format, filepath.Base(path), err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+// provenance returns the lines of the comment block that starts DOT output,
+// recording how the graph was produced: the git-graphviz version and, unless
+// -anonymize is given, the repository and the flags and arguments given on
+// the command line. Those could name objects, references and paths that the
+// anonymized graph leaves out.
+func provenance(r *git.Repository, opts *options) []string {
+	lines := []string{"generated by git-graphviz " + version}
+	repo := opts.pack
+	if fs, ok := sharedGitDir(r.Storer); ok && repo == "" {
+		repo = fs.Root()
+	}
+	if repo != "" && !opts.anonymize {
+		if abs, err := filepath.Abs(repo); err == nil {
+			repo = abs
+		}
+		lines = append(lines, "repository: "+repo)
+	}
+	if opts.anonymize {
+		return append(lines, "flags and arguments omitted by -anonymize")
+	}
+	var flags []string
+	flag.Visit(func(f *flag.Flag) {
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && f.Value.String() == "true" {
+			flags = append(flags, "-"+f.Name)
+			return
+		}
+		flags = append(flags, "-"+f.Name+"="+shellQuote(f.Value.String()))
+	})
+	if len(flags) > 0 {
+		lines = append(lines, "flags: "+strings.Join(flags, " "))
+	}
+	if flag.NArg() > 0 {
+		var args []string
+		for _, a := range flag.Args() {
+			args = append(args, shellQuote(a))
+		}
+		lines = append(lines, "arguments: "+strings.Join(args, " "))
+	}
+	return lines
+}
+
+// shellQuote returns s quoted if it is empty or holds characters that would
+// be ambiguous on a command line, such as spaces and newlines.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$`*?[]{}()<>|&;#~") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// renderProvenance writes the provenance block as DOT comments, followed by
+// the time of generation unless -deterministic is given.
+func renderProvenance(w io.Writer, opts *options) {
+	for _, l := range opts.provenance {
+		fmt.Fprintf(w, "// %s\n", l)
+	}
+	if !opts.deterministic {
+		fmt.Fprintf(w, "// generated at: %s\n", time.Now().UTC().Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+)
+
+// recordEscaper escapes the characters that are significant inside a DOT
+// record label, in addition to those of a double-quoted string.
+var recordEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`|`, `\|`,
+	`<`, `\<`,
+	`>`, `\>`,
+	"\n", `\n`,
+)
+
+// recordLabel returns the label of a record node for the tree h: a header
+// field naming the tree followed by one field per entry. Each field is given
+// a port so edges to subtrees can leave from the entry they belong to.
+func (g *graph) recordLabel(h plumbing.Hash, opts *options) string {
+	fields := []string{label(h, "tree", opts)}
+	if opts.labelTemplate != nil {
+		fields[0] = recordEscaper.Replace(wrapText(g.templateLabel(h, opts), opts.labelWrap))
+	}
+	for i, entry := range g.entries[h] {
+		name := recordEscaper.Replace(entry.Name)
+		if entry.Mode == filemode.Dir {
+			name += "/"
+		} else if n, ok := g.sizes[entry.Hash]; ok && opts.collapseBlobs {
+			name += " (" + formatSize(n) + ")"
+		}
+		fields = append(fields, fmt.Sprintf("<%s> %s", entryPort(i), name))
+	}
+	return "{" + strings.Join(fields, "|") + "}"
+}
+
+// formatSize formats a size in bytes for people to read, using binary
+// multiples like git count-objects -H.
+func formatSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	units := []string{"KiB", "MiB", "GiB"}
+	f, i := float64(n)/1024, 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
+
+// entryPort returns the record port name of the i'th entry of a tree.
+func entryPort(i int) string {
+	return fmt.Sprintf("e%d", i)
+}
+
+// entryIndex returns the index of the first entry of tree h that refers to
+// target, or -1 if there is none.
+func (g *graph) entryIndex(h, target plumbing.Hash) int {
+	for i, entry := range g.entries[h] {
+		if entry.Hash == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// inlineBlobs returns the blobs that are shown as fields of tree records
+// rather than as nodes of their own.
+func (g *graph) inlineBlobs() map[plumbing.Hash]bool {
+	inline := make(map[plumbing.Hash]bool)
+	for _, h := range g.hashes(treeType) {
+		for _, e := range g.edges[h] {
+			if e.role == treeEntry && g.is(e.target, blobType) {
+				inline[e.target] = true
+			}
+		}
+	}
+	return inline
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// followRenamesLimit is the most commits -follow-renames compares with their
+// parents. Each comparison reads every tree that differs between the two, so
+// on a long history the cost adds up to many times that of the walk itself.
+const followRenamesLimit = 1000
+
+// annotateRenames compares each commit in the graph with its first parent
+// and labels the edge to each file the commit renamed with the path it was
+// renamed from. Only exact renames are found, where the contents of the file
+// are unchanged; git's similarity scoring is not attempted.
+func (g *graph) annotateRenames(ctx context.Context, s storer.EncodedObjectStorer) error {
+	commits := g.hashes(commitType)
+	if len(commits) > followRenamesLimit {
+		warnf("-follow-renames: not looking for renames in %d commits, more than the %d allowed", len(commits), followRenamesLimit)
+		return nil
+	}
+	for _, h := range commits {
+		commit, err := object.GetCommit(s, h)
+		if err != nil {
+			return fmt.Errorf("annotateRenames %s: %v", h, err)
+		}
+		if len(commit.ParentHashes) == 0 || s.HasEncodedObject(commit.ParentHashes[0]) != nil {
+			continue
+		}
+		parent, err := object.GetCommit(s, commit.ParentHashes[0])
+		if err != nil {
+			return fmt.Errorf("annotateRenames %s: %v", h, err)
+		}
+		var added []fileChange
+		removed := make(map[plumbing.Hash][]string)
+		err = diffFiles(ctx, s, parent.TreeHash, commit.TreeHash, "", func(c fileChange) {
+			switch {
+			case c.from.IsZero():
+				added = append(added, c)
+			case c.to.IsZero():
+				removed[c.from] = append(removed[c.from], c.path)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("annotateRenames %s: %v", h, err)
+		}
+		for _, c := range added {
+			from := removed[c.to]
+			if len(from) == 0 {
+				continue
+			}
+			removed[c.to] = from[1:]
+			infof("commit %s renames %s to %s", h, from[0], c.path)
+			if err := g.labelRename(commit, c, from[0]); err != nil {
+				return fmt.Errorf("annotateRenames %s: %v", h, err)
+			}
+		}
+	}
+	return nil
+}
+
+// labelRename adds "renamed from" to the label of the edge by which the tree
+// of commit, or with -flatten-trees the commit itself, leads to the file c,
+// if that edge is in the graph.
+func (g *graph) labelRename(commit *object.Commit, c fileChange, from string) error {
+	src := commit.Hash
+	match := func(e edge) bool { return e.label == c.path }
+	if !g.opts.flattenTrees {
+		t, err := commit.Tree()
+		if err != nil {
+			return err
+		}
+		if dir := path.Dir(c.path); dir != "." {
+			if t, err = t.Tree(dir); err != nil {
+				return err
+			}
+		}
+		src = t.Hash
+		match = func(edge) bool { return true }
+	}
+	for i, e := range g.edges[src] {
+		if e.role != treeEntry || e.target != c.to || !match(e) {
+			continue
+		}
+		delete(g.edgeSet, edgeKey{src, e})
+		if e.label != "" {
+			e.label += "\n"
+		}
+		e.label += "renamed from " + from
+		g.edges[src][i] = e
+		g.edgeSet[edgeKey{src, e}] = true
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// resolveObject returns the object named by the reference or full or
+// abbreviated hash n.
+func resolveObject(r *git.Repository, n string) (plumbing.Hash, error) {
+	if ref, err := r.Reference(plumbing.ReferenceName(n), true); err == nil {
+		return ref.Hash(), nil
+	}
+	return resolveHash(r.Storer, n)
+}
+
+// resolveHash expands a full or abbreviated hex object name into the hash of
+// the single object in s that it identifies. Hex digits may be given in either
+// case, but errors quote name as given.
+func resolveHash(s storer.EncodedObjectStorer, name string) (plumbing.Hash, error) {
+	prefix := strings.ToLower(name)
+	if !isHex(prefix) || len(prefix) < minAbbrev || len(prefix) > len(plumbing.ZeroHash.String()) {
+		return plumbing.ZeroHash, fmt.Errorf("not a valid object name: %s", name)
+	}
+	if len(prefix) == len(plumbing.ZeroHash.String()) {
+		h := plumbing.NewHash(prefix)
+		if err := s.HasEncodedObject(h); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("%s: %v", name, err)
+		}
+		return h, nil
+	}
+	objs, err := s.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	var matches []plumbing.Hash
+	err = objs.ForEach(func(obj plumbing.EncodedObject) error {
+		if h := obj.Hash(); strings.HasPrefix(h.String(), prefix) {
+			matches = append(matches, h)
+		}
+		return nil
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	switch len(matches) {
+	case 0:
+		return plumbing.ZeroHash, fmt.Errorf("%s: %v", name, plumbing.ErrObjectNotFound)
+	case 1:
+		return matches[0], nil
+	}
+	return plumbing.ZeroHash, fmt.Errorf("short object name %s is ambiguous (%d matches)", name, len(matches))
+}
+
+func isHex(s string) bool {
+	if len(s)%2 == 1 {
+		s += "0"
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// checkHead makes sure that HEAD, symbolic or detached, resolves to an object
+// for -head, which walks from it as if HEAD were given as an argument.
+func checkHead(s storer.ReferenceStorer) error {
+	ref, err := storer.ResolveReference(s, plumbing.HEAD)
+	if err == plumbing.ErrReferenceNotFound {
+		if head, err := s.Reference(plumbing.HEAD); err == nil && head.Type() == plumbing.SymbolicReference {
+			return fmt.Errorf("-head: HEAD points at unborn branch %s, which has no commits yet", head.Target())
+		}
+		return fmt.Errorf("-head: HEAD not found")
+	}
+	if err != nil {
+		return fmt.Errorf("-head: %v", err)
+	}
+	if ref.Hash().IsZero() {
+		return fmt.Errorf("-head: HEAD does not point at an object")
+	}
+	return nil
+}
+
+// resolveTag returns the full name of the tag named by n for -since-tag,
+// which may be given with or without its refs/tags/ prefix.
+func resolveTag(r *git.Repository, n string) (plumbing.ReferenceName, error) {
+	name := plumbing.ReferenceName(n)
+	if !name.IsTag() {
+		name = plumbing.ReferenceName("refs/tags/" + n)
+	}
+	if _, err := r.Reference(name, false); err != nil {
+		return "", fmt.Errorf("-since-tag: no tag %s", n)
+	}
+	return name, nil
+}
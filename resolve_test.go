@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestResolveHash(t *testing.T) {
+	// Store blobs until two of them share the shortest prefix allowed.
+	s := memory.NewStorage()
+	byPrefix := make(map[string]plumbing.Hash)
+	var unique, shared plumbing.Hash
+	for i := 0; shared.IsZero(); i++ {
+		obj := s.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, err := obj.Writer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, "blob %d\n", i)
+		w.Close()
+		h, err := s.SetEncodedObject(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			unique = h
+		}
+		p := h.String()[:minAbbrev]
+		if _, ok := byPrefix[p]; ok {
+			shared = h
+		}
+		byPrefix[p] = h
+	}
+	absent := ""
+	for i := 0; absent == ""; i++ {
+		if p := fmt.Sprintf("%04x", i); byPrefix[p].IsZero() {
+			absent = p
+		}
+	}
+	uniqueName := unique.String()[:20]
+
+	tests := []struct {
+		name    string
+		want    plumbing.Hash
+		wantErr string
+	}{
+		{unique.String(), unique, ""},
+		{uniqueName, unique, ""},
+		{strings.ToUpper(uniqueName), unique, ""},
+		{shared.String()[:minAbbrev], plumbing.ZeroHash, "short object name " + shared.String()[:minAbbrev] + " is ambiguous (2 matches)"},
+		{unique.String()[:minAbbrev-1], plumbing.ZeroHash, "not a valid object name: " + unique.String()[:minAbbrev-1]},
+		{absent, plumbing.ZeroHash, absent + ": object not found"},
+		{"HEAD~3", plumbing.ZeroHash, "not a valid object name: HEAD~3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := resolveHash(s, tt.name)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("resolveHash(%q) error = %v, want %q", tt.name, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h != tt.want {
+				t.Errorf("resolveHash(%q) = %s, want %s", tt.name, h, tt.want)
+			}
+		})
+	}
+}
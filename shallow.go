@@ -0,0 +1,29 @@
+package main
+
+import (
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// loadShallow records the commits listed in the shallow file of a shallow
+// clone. Their parents are not in the repository, so with -allow-shallow the
+// walk stops at them instead of failing.
+func (g *graph) loadShallow(r *git.Repository) error {
+	hs, err := r.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+	for _, h := range hs {
+		g.shallow[h] = true
+	}
+	if len(hs) > 0 {
+		infof("shallow clone with %d boundary commits", len(hs))
+	}
+	return nil
+}
+
+// shallowBoundary reports whether the walk stops at the commit h because it
+// is on the boundary of a shallow clone and -allow-shallow is given.
+func (g *graph) shallowBoundary(h plumbing.Hash) bool {
+	return g.opts.allowShallow && g.shallow[h]
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// splitByRef renders a separate graph of the history reachable from each
+// branch and tag in the repository into the directory named by -output, in a
+// file named after the reference.
+func splitByRef(r *git.Repository, opts *options) error {
+	if err := os.MkdirAll(opts.output, 0777); err != nil {
+		return err
+	}
+	refs, err := r.References()
+	if err != nil {
+		return err
+	}
+	var names []string
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsBranch() || ref.Name().IsTag() {
+			names = append(names, ref.Name().String())
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	sort.Strings(names)
+	ext := formatExtension(opts.format)
+	for _, name := range names {
+		o := *opts
+		o.output = filepath.Join(opts.output, refFileName(name)+ext)
+		infof("split %s into %s", name, o.output)
+		if err := generate(r, []string{name}, &o); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// splitByArg walks each of the arguments on its own, rendering its graph into
+// the directory named by -output-dir in a file named after the argument.
+func splitByArg(r *git.Repository, args []string, opts *options) error {
+	if err := os.MkdirAll(opts.outputDir, 0777); err != nil {
+		return err
+	}
+	ext := formatExtension(opts.format)
+	files := make(map[string]string)
+	for _, arg := range args {
+		name := refFileName(arg) + ext
+		if prev, ok := files[name]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s", prev, arg, name)
+		}
+		files[name] = arg
+	}
+	for _, arg := range args {
+		o := *opts
+		o.output = filepath.Join(opts.outputDir, refFileName(arg)+ext)
+		infof("graph %s into %s", arg, o.output)
+		if err := generate(r, []string{arg}, &o); err != nil {
+			return fmt.Errorf("%s: %v", arg, err)
+		}
+	}
+	return nil
+}
+
+// refFileName turns a reference name into a file name, dropping the leading
+// refs/ and replacing the slashes and other characters that are not safe in
+// file names with underscores.
+func refFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, strings.TrimPrefix(name, "refs/"))
+}
+
+// formatExtension returns the file extension for files in the given format,
+// the lexically first when -output recognizes several.
+func formatExtension(format string) string {
+	ext := ""
+	for e, f := range extensionFormats {
+		if f == format && (ext == "" || e < ext) {
+			ext = e
+		}
+	}
+	if ext == "" {
+		return "." + format
+	}
+	return ext
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// stashParents names the parents of a stash commit, in order: the commit
+// that was checked out, the commit recording the index, and, for git stash
+// -u, the commit recording the untracked files.
+var stashParents = []string{"HEAD", "index", "untracked"}
+
+// walkStash walks refs/stash along with every earlier stash entry in its
+// reflog, numbering them stash@{0}, stash@{1} and so on, newest first.
+func (g *graph) walkStash(ctx context.Context, r *git.Repository) error {
+	ref, err := r.Reference(plumbing.ReferenceName("refs/stash"), false)
+	if err == plumbing.ErrReferenceNotFound {
+		infof("no stash to walk")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries, err := stashReflog(r.Storer)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		entries = []plumbing.Hash{ref.Hash()}
+	}
+	for i, h := range entries {
+		if _, ok := g.stashes[h]; !ok {
+			g.stashes[h] = len(entries) - 1 - i
+		}
+	}
+	if err := g.walkRef(ctx, r.Storer, ref); err != nil {
+		return err
+	}
+	for _, h := range entries {
+		g.roots[h] = true
+		g.requested[h] = true
+		if err := g.walkCommit(ctx, r.Storer, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stashReflog returns the commits recorded in the reflog of refs/stash,
+// oldest first, or none if the repository has no such reflog.
+func stashReflog(s storage.Storer) ([]plumbing.Hash, error) {
+	fs, ok := sharedGitDir(s)
+	if !ok {
+		return nil, nil
+	}
+	f, err := fs.Open(fs.Join("logs", "refs", "stash"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var hashes []plumbing.Hash
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// <old> <new> <committer> <time> <zone>\t<message>
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || len(fields[1]) != len(plumbing.ZeroHash.String()) || !isHex(fields[1]) {
+			return nil, fmt.Errorf("logs/refs/stash: malformed entry %q", sc.Text())
+		}
+		hashes = append(hashes, plumbing.NewHash(fields[1]))
+	}
+	return hashes, sc.Err()
+}
+
+// sharedGitDir returns the file system of the git directory holding the
+// references and logs of the repository, or false if it is not stored on
+// the file system.
+func sharedGitDir(s storage.Storer) (billy.Filesystem, bool) {
+	if a, ok := s.(*alternateStorer); ok {
+		s = a.Storer
+	}
+	if o, ok := s.(*objectDirStorer); ok {
+		s = o.Storer
+	}
+	if c, ok := s.(*commonDirStorer); ok {
+		s = c.Storer
+	}
+	fs, ok := s.(*filesystem.Storage)
+	if !ok {
+		return nil, false
+	}
+	return fs.Filesystem(), true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// authorStats is the document written by -stats=json.
+type authorStats struct {
+	Authors []authorCount `json:"authors"`
+	Total   int           `json:"total"`
+}
+
+// authorCount is the number of commits in the graph by one author, identified
+// by name and email address.
+type authorCount struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Commits int    `json:"commits"`
+}
+
+// authorCounts counts the commits in the graph by author, most first and
+// then by name and email. Commits not decoded by the walk, such as missing
+// ones, are not counted.
+func (g *graph) authorCounts() authorStats {
+	counts := make(map[authorCount]int)
+	stats := authorStats{Authors: []authorCount{}}
+	for _, h := range g.hashes(commitType) {
+		ci, ok := g.info[h]
+		if !ok {
+			continue
+		}
+		counts[authorCount{Name: ci.author.Name, Email: ci.author.Email}]++
+		stats.Total++
+	}
+	for a, n := range counts {
+		a.Commits = n
+		stats.Authors = append(stats.Authors, a)
+	}
+	sort.Slice(stats.Authors, func(i, j int) bool {
+		a, b := stats.Authors[i], stats.Authors[j]
+		if a.Commits != b.Commits {
+			return a.Commits > b.Commits
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Email < b.Email
+	})
+	return stats
+}
+
+// writeStats writes the number of commits in the graph by each author for
+// -stats, as a table or, with -stats=json, a JSON document.
+func writeStats(w io.Writer, g *graph, opts *options) error {
+	stats := g.authorCounts()
+	if opts.stats == "json" {
+		enc := json.NewEncoder(w)
+		if opts.pretty {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(stats)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMMITS\tAUTHOR")
+	for _, a := range stats.Authors {
+		fmt.Fprintf(tw, "%d\t%s <%s>\n", a.Commits, a.Name, a.Email)
+	}
+	fmt.Fprintf(tw, "%d\ttotal, %d authors\n", stats.Total, len(stats.Authors))
+	return tw.Flush()
+}
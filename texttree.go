@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// textTreeLimit is the largest number of commits -format=text-tree will lay
+// out. Beyond it the drawing gets too wide and tangled to read.
+const textTreeLimit = 500
+
+// renderTextTree draws the commits of the graph in the style of git log
+// --graph, newest first, with each commit on a row of its own marked by an
+// asterisk in the column of the line of history it is on. Tags, trees and
+// blobs are left out.
+func renderTextTree(out io.Writer, g *graph, opts *options) error {
+	if n := g.count(commitType); n > textTreeLimit {
+		return fmt.Errorf("-format=text-tree: %d commits is more than the limit of %d", n, textTreeLimit)
+	}
+	// Tags are not drawn, so their references decorate the commits they
+	// tag, as in git log.
+	decorations := make(map[plumbing.Hash][]string)
+	for h, ds := range g.refDecorations() {
+		h = g.peel(h)
+		decorations[h] = append(decorations[h], ds...)
+	}
+	for _, ds := range decorations {
+		sort.Strings(ds)
+	}
+	w := bufio.NewWriter(out)
+	var cols []plumbing.Hash
+	for _, c := range g.newestFirst() {
+		idx := -1
+		for i, h := range cols {
+			if h == c {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			cols = append(cols, c)
+			idx = len(cols) - 1
+		}
+		// Lines of history that lead to the same commit join it here,
+		// rightmost first, each into the nearest line to its left that
+		// leads there too.
+		for j := len(cols) - 1; j > idx; j-- {
+			if cols[j] == c {
+				target := j - 1
+				for cols[target] != c {
+					target--
+				}
+				cols = append(cols[:j], cols[j+1:]...)
+				textTreeRemove(w, len(cols), j, target)
+			}
+		}
+
+		row := textTreeRow(len(cols))
+		for i := range cols {
+			row[2*i] = '|'
+		}
+		row[2*idx] = '*'
+		fmt.Fprintf(w, "%s  %s", bytes.TrimRight(row, " "), abbrev(c, opts.abbrev))
+		if ds, ok := decorations[c]; ok {
+			fmt.Fprintf(w, " (%s)", strings.Join(ds, ", "))
+		}
+		if subject := strings.SplitN(g.info[c].message, "\n", 2)[0]; subject != "" {
+			fmt.Fprintf(w, " %s", subject)
+		}
+		fmt.Fprintln(w)
+
+		parents := g.parents(c)
+		if len(parents) == 0 {
+			cols = append(cols[:idx], cols[idx+1:]...)
+			if idx < len(cols) {
+				textTreeRemove(w, len(cols), idx, -1)
+			}
+			continue
+		}
+		cols[idx] = parents[0]
+		for k, p := range parents[1:] {
+			q := idx + k + 1
+			cols = append(cols[:q], append([]plumbing.Hash{p}, cols[q:]...)...)
+			textTreeInsert(w, len(cols), q)
+		}
+	}
+	return w.Flush()
+}
+
+// textTreeInsert writes the line opening a new column at position q, out of
+// n columns after it is added, branching off the column to its left. The
+// columns from q onwards slant right to make room.
+func textTreeInsert(w io.Writer, n, q int) {
+	row := textTreeRow(n)
+	for i := 0; i < n; i++ {
+		if i < q {
+			row[2*i] = '|'
+		} else {
+			row[2*i-1] = '\\'
+		}
+	}
+	fmt.Fprintf(w, "%s\n", bytes.TrimRight(row, " "))
+}
+
+// textTreeRemove writes the lines closing the column at position q, leaving n
+// columns. The columns to its right slant left to take its place. Unless
+// target is negative, the closed column is drawn merging into the column at
+// position target to its left: directly if it is the next one, or otherwise
+// along the bottom of the columns in between and then into it on a second
+// line, as git log --graph draws it.
+func textTreeRemove(w io.Writer, n, q, target int) {
+	row := textTreeRow(n + 1)
+	for i := 0; i < n; i++ {
+		if i < q {
+			row[2*i] = '|'
+		} else {
+			row[2*i+1] = '/'
+		}
+	}
+	if target < 0 {
+		fmt.Fprintf(w, "%s\n", bytes.TrimRight(row, " "))
+		return
+	}
+	row[2*q-1] = '/'
+	for i := target + 1; i < q-1; i++ {
+		row[2*i+1] = '_'
+	}
+	fmt.Fprintf(w, "%s\n", bytes.TrimRight(row, " "))
+	if target == q-1 {
+		return
+	}
+	row = textTreeRow(n)
+	for i := 0; i < n; i++ {
+		row[2*i] = '|'
+	}
+	row[2*target+1] = '/'
+	fmt.Fprintf(w, "%s\n", bytes.TrimRight(row, " "))
+}
+
+func textTreeRow(n int) []byte {
+	return bytes.Repeat([]byte(" "), 2*n)
+}
+
+// newestFirst orders the commits of the graph so every commit comes before
+// its parents, choosing the most recently committed of those that are ready
+// at each step, like git log --graph.
+func (g *graph) newestFirst() []plumbing.Hash {
+	children := make(map[plumbing.Hash]int)
+	commits := g.hashes(commitType)
+	for _, h := range commits {
+		for _, p := range g.parents(h) {
+			children[p]++
+		}
+	}
+	var ready, order []plumbing.Hash
+	for _, h := range commits {
+		if children[h] == 0 {
+			ready = append(ready, h)
+		}
+	}
+	for len(ready) > 0 {
+		sortHashes(ready)
+		g.sortCommitsByTime(ready)
+		h := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		order = append(order, h)
+		for _, p := range g.parents(h) {
+			if children[p]--; children[p] == 0 {
+				ready = append(ready, p)
+			}
+		}
+	}
+	return order
+}
+
+// peel follows tags in the graph from h to the object they ultimately tag.
+func (g *graph) peel(h plumbing.Hash) plumbing.Hash {
+	seen := make(map[plumbing.Hash]bool)
+	for g.is(h, tagType) && !seen[h] {
+		seen[h] = true
+		for _, e := range g.edges[h] {
+			if e.role == tagTarget {
+				h = e.target
+			}
+		}
+	}
+	return h
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTextTreeRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		n, q   int
+		target int
+		want   string
+	}{
+		{"closed", 2, 2, -1, "| |\n"},
+		{"closed with columns to the right", 2, 1, -1, "|  /\n"},
+		{"joined to the next column", 2, 2, 1, "| |/\n"},
+		{"joined across a column", 2, 2, 0, "| |/\n|/|\n"},
+		{"joined across columns", 4, 4, 0, "| |_|_|/\n|/| | |\n"},
+		{"joined across columns with columns to the right", 5, 4, 1, "| | |_|/ /\n| |/| | |\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			textTreeRemove(&buf, tt.n, tt.q, tt.target)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("textTreeRemove(%d, %d, %d) =\n%s\nwant\n%s", tt.n, tt.q, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestTextTreeOctopus checks that the lines of a merge with three parents
+// join the lines they lead to, even when another line lies between them.
+func TestTextTreeOctopus(t *testing.T) {
+	f := newFixture(t)
+	root := f.commit("root")
+	a := f.commit("a")
+	f.git("checkout", "-q", "-b", "b", root)
+	b := f.commit("b")
+	f.git("checkout", "-q", "-b", "c", a)
+	c := f.commit("c")
+	m := f.commitTree("merge", a, b, c)
+	f.git("checkout", "-q", "main")
+	f.git("reset", "-q", "--hard", m)
+
+	opts := testOptions()
+	opts.format = "text-tree"
+	got := f.render(opts)
+	want := `*  ` + m[:6] + ` (HEAD -> main) merge
+|\
+| |\
+| | *  ` + c[:6] + ` (c) c
+| * |  ` + b[:6] + ` (b) b
+| |/
+|/|
+* |  ` + a[:6] + ` a
+|/
+*  ` + root[:6] + ` root
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// version is the release of git-graphviz, set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+const goGitModule = "gopkg.in/src-d/go-git.v4"
+
+// printVersion writes the git-graphviz version along with the version of
+// go-git it was built against, when that is recorded in the binary.
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "git-graphviz %s\n", version)
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != goGitModule {
+			continue
+		}
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		fmt.Fprintf(w, "go-git %s\n", dep.Version)
+	}
+}
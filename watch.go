@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// debounce is how long the repository must be quiet before the graph is
+// regenerated. Git operations typically touch many files in quick
+// succession, so rendering on every event would be wasteful.
+const debounce = 200 * time.Millisecond
+
+// watch renders the graph once and then again each time the references or
+// objects in the repository change, until an error occurs in the watcher. r
+// locates the directories to watch.
+func watch(r *git.Repository, args []string, opts *options) error {
+	st := r.Storer
+	if a, ok := st.(*alternateStorer); ok {
+		st = a.Storer
+	}
+	objects := ""
+	if o, ok := st.(*objectDirStorer); ok {
+		objects = o.dir
+		st = o.Storer
+	}
+	// A linked worktree keeps HEAD in its own git directory but shares
+	// refs and objects through the common directory.
+	var local string
+	if c, ok := st.(*commonDirStorer); ok {
+		local = c.local.Filesystem().Root()
+		st = c.Storer
+	}
+	s, ok := st.(*filesystem.Storage)
+	if !ok {
+		return fmt.Errorf("-watch requires a repository stored on the filesystem")
+	}
+	gitdir := s.Filesystem().Root()
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// fsnotify does not watch recursively, so add the git directory itself
+	// (HEAD, packed-refs) along with every directory beneath refs and objects.
+	if err := w.Add(gitdir); err != nil {
+		return err
+	}
+	if local != "" {
+		if err := w.Add(local); err != nil {
+			return err
+		}
+	}
+	if objects == "" {
+		objects = filepath.Join(gitdir, "objects")
+	}
+	for _, dir := range []string{filepath.Join(gitdir, "refs"), objects} {
+		if err := addTree(w, dir); err != nil {
+			return err
+		}
+	}
+
+	regenerate := func() {
+		// go-git keeps the index of each pack it has read for the life of
+		// the repository, so after a repack it would go on looking for
+		// packs that are gone. The repository is reopened each time.
+		r, err := openRepository(opts)
+		if err == nil {
+			err = generate(r, args, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "git-graphviz: Error: %v\n", err)
+		}
+	}
+	regenerate()
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					if err := addTree(w, ev.Name); err != nil {
+						return err
+					}
+				}
+			}
+			timer.Reset(debounce)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-timer.C:
+			regenerate()
+		}
+	}
+}
+
+// addTree adds dir and all directories beneath it to the watcher.
+func addTree(w *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return w.Add(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import "strings"
+
+// wrapText breaks each line of s into lines of at most n characters for
+// -label-wrap, preferring to break at spaces, which are dropped, or after a
+// slash or hyphen, so reference names break between their components. Words
+// longer than n are split wherever they reach it. s is wrapped before it is
+// escaped, so the breaks become ordinary label line breaks. A non-positive n
+// leaves s unchanged.
+func wrapText(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = wrapLine(l, n)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func wrapLine(s string, n int) string {
+	var out []string
+	line := ""
+	for _, word := range wrapWords(s) {
+		trimmed := strings.TrimSuffix(word, " ")
+		if line != "" && len([]rune(line))+len([]rune(trimmed)) > n {
+			out = append(out, strings.TrimRight(line, " "))
+			line = ""
+		}
+		for len([]rune(strings.TrimSuffix(word, " "))) > n {
+			r := []rune(word)
+			out = append(out, string(r[:n]))
+			word = string(r[n:])
+		}
+		line += word
+	}
+	return strings.Join(append(out, strings.TrimRight(line, " ")), "\n")
+}
+
+// wrapWords splits s after each space, slash and hyphen, so that joining the
+// words gives s back.
+func wrapWords(s string) []string {
+	var words []string
+	start := 0
+	for i, r := range s {
+		if r == ' ' || r == '/' || r == '-' {
+			words = append(words, s[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}